@@ -1,7 +1,27 @@
 package opinionatedevents
 
-import "context"
+import (
+	"context"
+	"log/slog"
+	"time"
+)
 
 type bridge interface {
 	take(ctx context.Context, batch []*Message) *envelope
+	setLogger(logger *slog.Logger)
+	setMetrics(metrics Metrics)
+}
+
+// deliverWithMetrics delivers the batch to the destination and records the outcome
+func deliverWithMetrics(ctx context.Context, metrics Metrics, destination Destination, batch []*Message) error {
+	labels := Labels{"destination": destinationName(destination)}
+	startedAt := time.Now()
+	err := destination.Deliver(ctx, batch)
+	metrics.ObserveHistogram(MetricPublishDuration, labels, time.Since(startedAt).Seconds())
+	if err != nil {
+		metrics.AddCounter(MetricPublishErrors, labels, 1)
+		return err
+	}
+	metrics.AddCounter(MetricPublishedMessages, labels, float64(len(batch)))
+	return nil
 }
@@ -2,6 +2,8 @@ package opinionatedevents
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"time"
 )
 
@@ -13,6 +15,8 @@ type asyncBridgeDeliveryConfig struct {
 type asyncBridge struct {
 	destinations   []Destination
 	deliveryConfig *asyncBridgeDeliveryConfig
+	logger         *slog.Logger
+	metrics        Metrics
 }
 
 func newAsyncBridge(maxDeliveryAttempts int, waitBetweenAttempts int, destinations ...Destination) *asyncBridge {
@@ -22,9 +26,19 @@ func newAsyncBridge(maxDeliveryAttempts int, waitBetweenAttempts int, destinatio
 			maxAttempts: maxDeliveryAttempts,
 			waitBetween: waitBetweenAttempts,
 		},
+		logger:  slog.Default(),
+		metrics: &noopMetrics{},
 	}
 }
 
+func (b *asyncBridge) setLogger(logger *slog.Logger) {
+	b.logger = logger
+}
+
+func (b *asyncBridge) setMetrics(metrics Metrics) {
+	b.metrics = metrics
+}
+
 func (b *asyncBridge) take(ctx context.Context, batch []*Message) *envelope {
 	env := newEnvelope(ctx, batch)
 	go b.deliver(env)
@@ -34,13 +48,37 @@ func (b *asyncBridge) take(ctx context.Context, batch []*Message) *envelope {
 func (b *asyncBridge) deliver(envelope *envelope) {
 	destinations := b.destinations
 	attemptsLeft := b.deliveryConfig.maxAttempts
+	failed := false
 	// attempt to deliver until no more attempts left
 	for attemptsLeft > 0 {
 		attemptsLeft -= 1
 		// try delivering the message to all (pending) destinations
 		deliveredTo := []int{}
+		var retryAt time.Time
 		for i, destination := range destinations {
-			if err := destination.Deliver(envelope.ctx, envelope.batch); err == nil {
+			if err := deliverWithMetrics(envelope.ctx, b.metrics, destination, envelope.batch); err != nil {
+				if IsFatal(err) {
+					// retrying would not help (e.g. the receiver dropped the messages), so the destination is given up
+					labels := Labels{"destination": destinationName(destination)}
+					b.metrics.AddCounter(MetricPublishFailures, labels, float64(len(envelope.batch)))
+					b.logger.ErrorContext(envelope.ctx, "failed to deliver a batch of messages to a destination",
+						"error", err,
+						"size", len(envelope.batch),
+					)
+					deliveredTo = append(deliveredTo, i)
+					failed = true
+					continue
+				}
+				var retryErr *retryError
+				if errors.As(err, &retryErr) && retryErr.retryAt.After(retryAt) {
+					retryAt = retryErr.retryAt
+				}
+				b.logger.WarnContext(envelope.ctx, "failed to deliver a batch of messages to a destination",
+					"error", err,
+					"size", len(envelope.batch),
+					"attempts_left", attemptsLeft,
+				)
+			} else {
 				deliveredTo = append(deliveredTo, i)
 			}
 		}
@@ -61,14 +99,26 @@ func (b *asyncBridge) deliver(envelope *envelope) {
 		destinations = tmp
 		// if there are no more pending destinations, we are done
 		if len(destinations) == 0 {
+			if failed {
+				envelope.closeWith(newDeliveryEvent(deliveryEventFailureName))
+				break
+			}
 			envelope.closeWith(newDeliveryEvent(deliveryEventSuccessName))
 			break
 		}
 		// otherwise, possibly try again or fail with an error
 		if attemptsLeft > 0 {
-			waitFor := time.Duration(b.deliveryConfig.waitBetween)
-			time.Sleep(waitFor * time.Millisecond)
+			for _, destination := range destinations {
+				b.metrics.AddCounter(MetricPublishRetries, Labels{"destination": destinationName(destination)}, 1)
+			}
+			// the destinations may ask for a longer wait, e.g. with a `Retry-After` header
+			waitFor := max(time.Duration(b.deliveryConfig.waitBetween)*time.Millisecond, time.Until(retryAt))
+			time.Sleep(waitFor)
 		} else {
+			for _, destination := range destinations {
+				labels := Labels{"destination": destinationName(destination)}
+				b.metrics.AddCounter(MetricPublishFailures, labels, float64(len(envelope.batch)))
+			}
 			envelope.closeWith(newDeliveryEvent(deliveryEventFailureName))
 		}
 	}
@@ -1,20 +1,38 @@
 package opinionatedevents
 
-import "context"
+import (
+	"context"
+	"log/slog"
+)
 
 type syncBridge struct {
 	destinations []Destination
+	logger       *slog.Logger
+	metrics      Metrics
 }
 
 func newSyncBridge(destinations ...Destination) *syncBridge {
-	return &syncBridge{destinations: destinations}
+	return &syncBridge{destinations: destinations, logger: slog.Default(), metrics: &noopMetrics{}}
+}
+
+func (b *syncBridge) setLogger(logger *slog.Logger) {
+	b.logger = logger
+}
+
+func (b *syncBridge) setMetrics(metrics Metrics) {
+	b.metrics = metrics
 }
 
 func (b *syncBridge) take(ctx context.Context, batch []*Message) *envelope {
 	env := newEnvelope(ctx, batch)
 	var possibleErr error = nil
 	for _, d := range b.destinations {
-		if err := d.Deliver(ctx, batch); err != nil {
+		if err := deliverWithMetrics(ctx, b.metrics, d, batch); err != nil {
+			b.metrics.AddCounter(MetricPublishFailures, Labels{"destination": destinationName(d)}, float64(len(batch)))
+			b.logger.ErrorContext(ctx, "failed to deliver a batch of messages to a destination",
+				"error", err,
+				"size", len(batch),
+			)
 			possibleErr = err
 		}
 	}
@@ -0,0 +1,62 @@
+package opinionatedevents
+
+import "context"
+
+// the headers used for the correlation and causation ids
+const (
+	HeaderCorrelationID string = "correlation_id"
+	HeaderCausationID   string = "causation_id"
+)
+
+// GetCorrelationID returns the id shared by every message of a chain, i.e. the uuid of the message which started it.
+func (msg *Message) GetCorrelationID() string {
+	return msg.GetHeader(HeaderCorrelationID)
+}
+
+// GetCausationID returns the uuid of the message which caused this message to be published.
+func (msg *Message) GetCausationID() string {
+	return msg.GetHeader(HeaderCausationID)
+}
+
+// WithCorrelationID sets the correlation id of the message, instead of inheriting it from the handled message.
+func WithCorrelationID(correlationID string) MessageOption {
+	return WithHeader(HeaderCorrelationID, correlationID)
+}
+
+// WithCausationID sets the causation id of the message, instead of using the uuid of the handled message.
+func WithCausationID(causationID string) MessageOption {
+	return WithHeader(HeaderCausationID, causationID)
+}
+
+type causationContextKey struct{}
+
+// withCausingMessage marks the message as the cause of every message published with the context
+func withCausingMessage(ctx context.Context, msg *Message) context.Context {
+	return context.WithValue(ctx, causationContextKey{}, msg)
+}
+
+// propagateCausation sets the correlation and causation ids of the messages which do not have them yet. A message
+// published by a handler inherits the correlation id of the handled message and is caused by it, while any other
+// message starts a new chain.
+func propagateCausation(ctx context.Context, batch []*Message) {
+	cause, _ := ctx.Value(causationContextKey{}).(*Message)
+	for _, msg := range batch {
+		if cause == nil {
+			if msg.GetCorrelationID() == "" {
+				WithCorrelationID(msg.GetUUID())(msg)
+			}
+			continue
+		}
+		if msg.GetCorrelationID() == "" {
+			correlationID := cause.GetCorrelationID()
+			if correlationID == "" {
+				// the handled message was published before the correlation ids, so it is considered the start
+				correlationID = cause.GetUUID()
+			}
+			WithCorrelationID(correlationID)(msg)
+		}
+		if msg.GetCausationID() == "" {
+			WithCausationID(cause.GetUUID())(msg)
+		}
+	}
+}
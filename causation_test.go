@@ -0,0 +1,82 @@
+package opinionatedevents
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCausation(t *testing.T) {
+	t.Run("starts a new chain outside of handlers", func(t *testing.T) {
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		propagateCausation(context.Background(), []*Message{msg})
+		assert.Equal(t, msg.GetUUID(), msg.GetCorrelationID())
+		assert.Equal(t, "", msg.GetCausationID())
+	})
+
+	t.Run("does not override explicit ids", func(t *testing.T) {
+		cause, err := NewMessage("customers.created", nil, WithCorrelationID("request-1"))
+		assert.NoError(t, err)
+		msg, err := NewMessage("crm.synced", nil, WithCorrelationID("request-2"), WithCausationID("other"))
+		assert.NoError(t, err)
+		propagateCausation(withCausingMessage(context.Background(), cause), []*Message{msg})
+		assert.Equal(t, "request-2", msg.GetCorrelationID())
+		assert.Equal(t, "other", msg.GetCausationID())
+	})
+
+	t.Run("propagates the ids from the handled message", func(t *testing.T) {
+		bus := NewMemoryBus()
+		publisher, err := NewPublisher(PublisherWithSyncBridge(NewMemoryDestination(bus)))
+		assert.NoError(t, err)
+		source, err := NewMemorySource(bus)
+		assert.NoError(t, err)
+		for _, topic := range []string{"customers", "crm", "email"} {
+			assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: topic, Queue: "default"}))
+		}
+		receiver, err := NewReceiver(ReceiverWithSource(source))
+		assert.NoError(t, err)
+		republish := func(name string) OnMessageHandler {
+			return func(ctx context.Context, _ Delivery) error {
+				msg, err := NewMessage(name, nil)
+				if err != nil {
+					return err
+				}
+				return publisher.PublishOne(ctx, msg)
+			}
+		}
+		received := make(chan *Message, 1)
+		assert.NoError(t, receiver.On("default", "customers.created", republish("crm.synced")))
+		assert.NoError(t, receiver.On("default", "crm.synced", republish("email.sent")))
+		assert.NoError(t, receiver.On("default", "email.sent", func(_ context.Context, delivery Delivery) error {
+			received <- delivery.GetMessage()
+			return nil
+		}))
+		assert.NoError(t, receiver.Start(context.Background()))
+		defer receiver.Stop(context.Background()) //nolint the error is not relevant
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		var last *Message
+		select {
+		case last = <-received:
+		case <-time.After(time.Second):
+			t.Fatal("the chain of messages was not handled")
+		}
+		assert.Equal(t, msg.GetUUID(), last.GetCorrelationID())
+		assert.NotEqual(t, msg.GetUUID(), last.GetCausationID())
+		// the causing message should be the one in between
+		bus.mutex.Lock()
+		defer bus.mutex.Unlock()
+		for _, event := range bus.events {
+			if event.name == "crm.synced" {
+				between := &Message{}
+				assert.NoError(t, between.UnmarshalJSON(event.payload))
+				assert.Equal(t, msg.GetUUID(), between.GetCausationID())
+				assert.Equal(t, between.GetUUID(), last.GetCausationID())
+			}
+		}
+	})
+}
@@ -0,0 +1,453 @@
+package opinionatedevents
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CloudEventsMode selects how messages are encoded as CloudEvents 1.0 over HTTP.
+type CloudEventsMode int
+
+const (
+	// CloudEventsStructured sends every message in its own request as `application/cloudevents+json`.
+	CloudEventsStructured CloudEventsMode = iota + 1
+	// CloudEventsBatched sends the whole batch in a single request as `application/cloudevents-batch+json`.
+	CloudEventsBatched
+	// CloudEventsBinary sends every message in its own request with the attributes as `ce-*` headers and the payload
+	// as the body.
+	CloudEventsBinary
+)
+
+const (
+	cloudEventsSpecVersion    string = "1.0"
+	cloudEventsStructuredType string = "application/cloudevents+json"
+	cloudEventsBatchedType    string = "application/cloudevents-batch+json"
+	// the extensions used for the fields of a message which have no CloudEvents attribute
+	cloudEventsDeliverAtExtension     string = "deliverat"
+	cloudEventsCorrelationIDExtension string = "correlationid"
+	cloudEventsCausationIDExtension   string = "causationid"
+	cloudEventsVersionExtension       string = "dataversion"
+	cloudEventsKeyIDExtension         string = "encryptionkeyid"
+	cloudEventsDataKeyExtension       string = "encryptiondatakey"
+	// the ordering key uses the name of the partitioning extension
+	cloudEventsOrderingKeyExtension string = "partitionkey"
+	cloudEventsPriorityExtension    string = "priority"
+	cloudEventsExpiresAtExtension   string = "expiresat"
+)
+
+// the extension names are restricted to lowercase letters and digits
+var cloudEventsExtensionPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// the headers which are renamed when mapped to extensions
+var cloudEventsHeaderExtensions = map[string]string{
+	HeaderCorrelationID: cloudEventsCorrelationIDExtension,
+	HeaderCausationID:   cloudEventsCausationIDExtension,
+}
+
+// the extensions which carry the fields of a message, the headers cannot use these names
+var cloudEventsMessageExtensions = []string{
+	cloudEventsDeliverAtExtension, cloudEventsCorrelationIDExtension, cloudEventsCausationIDExtension,
+	cloudEventsVersionExtension, cloudEventsKeyIDExtension, cloudEventsDataKeyExtension, cloudEventsOrderingKeyExtension,
+	cloudEventsPriorityExtension, cloudEventsExpiresAtExtension, "traceparent", "tracestate",
+}
+
+var cloudEventsContextAttributes = []string{
+	"specversion", "id", "source", "type", "subject", "time", "datacontenttype", "dataschema", "data", "data_base64",
+}
+
+type cloudEvent struct {
+	ID              string
+	Source          string
+	Type            string
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	Data            []byte
+	Extensions      map[string]string
+}
+
+// newCloudEvent maps a message to a CloudEvent: uuid to id, name to type, topic to source and subject and published at
+// to time.
+// The rest of the message (deliver at, expires at, version, ordering key, priority, trace context and headers) is
+// carried as extensions.
+func newCloudEvent(msg *Message) (*cloudEvent, error) {
+	event := &cloudEvent{
+		ID:              msg.GetUUID(),
+		Source:          msg.GetTopic(),
+		Type:            msg.GetName(),
+		Subject:         msg.GetTopic(),
+		Time:            msg.GetPublishedAt().UTC(),
+		DataContentType: msg.GetContentType(),
+		Data:            msg.payload,
+		Extensions:      map[string]string{},
+	}
+	if !msg.GetDeliverAt().IsZero() && !msg.GetDeliverAt().Equal(msg.GetPublishedAt()) {
+		event.Extensions[cloudEventsDeliverAtExtension] = msg.GetDeliverAt().UTC().Format(time.RFC3339Nano)
+	}
+	if !msg.GetExpiresAt().IsZero() {
+		event.Extensions[cloudEventsExpiresAtExtension] = msg.GetExpiresAt().UTC().Format(time.RFC3339Nano)
+	}
+	if msg.version > 0 {
+		event.Extensions[cloudEventsVersionExtension] = strconv.Itoa(msg.version)
+	}
+	if msg.orderingKey != "" {
+		event.Extensions[cloudEventsOrderingKeyExtension] = msg.orderingKey
+	}
+	if msg.priority != 0 {
+		event.Extensions[cloudEventsPriorityExtension] = strconv.Itoa(msg.priority)
+	}
+	if msg.encryption != nil {
+		event.Extensions[cloudEventsKeyIDExtension] = msg.encryption.keyID
+		event.Extensions[cloudEventsDataKeyExtension] = base64.StdEncoding.EncodeToString(msg.encryption.dataKey)
+	}
+	// the trace context uses the names of the distributed tracing extension, i.e. `traceparent` and `tracestate`
+	for key, value := range msg.trace {
+		event.Extensions[key] = value
+	}
+	for key, value := range msg.headers {
+		name, ok := cloudEventsHeaderExtensions[key]
+		if !ok {
+			name = key
+			// the header would overwrite (or be read back as) a field of the message
+			if slices.Contains(cloudEventsMessageExtensions, name) {
+				return nil, fmt.Errorf("header %q is reserved for a CloudEvents extension of the message", key)
+			}
+		}
+		if !cloudEventsExtensionPattern.MatchString(name) || isCloudEventsReservedName(name) {
+			return nil, fmt.Errorf("header %q cannot be represented as a CloudEvents extension", key)
+		}
+		event.Extensions[name] = value
+	}
+	return event, nil
+}
+
+func (e *cloudEvent) toMessage() (*Message, error) {
+	if e.ID == "" || e.Type == "" || e.Source == "" {
+		return nil, errors.New("a CloudEvent must have an id, a type and a source")
+	}
+	msg := &Message{
+		contentType: e.DataContentType,
+		uuid:        e.ID,
+		name:        e.Type,
+		publishedAt: e.Time,
+		deliverAt:   e.Time,
+		payload:     e.Data,
+	}
+	if msg.publishedAt.IsZero() {
+		msg.publishedAt = time.Now()
+		msg.deliverAt = msg.publishedAt
+	}
+	for name, value := range e.Extensions {
+		switch name {
+		case cloudEventsDeliverAtExtension:
+			deliverAt, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s extension: %w", name, err)
+			}
+			msg.deliverAt = deliverAt
+		case cloudEventsExpiresAtExtension:
+			expiresAt, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s extension: %w", name, err)
+			}
+			msg.expiresAt = expiresAt
+		case cloudEventsVersionExtension:
+			version, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s extension: %w", name, err)
+			}
+			msg.version = version
+		case cloudEventsOrderingKeyExtension:
+			msg.orderingKey = value
+		case cloudEventsPriorityExtension:
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s extension: %w", name, err)
+			}
+			msg.priority = priority
+		case cloudEventsKeyIDExtension:
+			if msg.encryption == nil {
+				msg.encryption = &messageEncryption{}
+			}
+			msg.encryption.keyID = value
+		case cloudEventsDataKeyExtension:
+			dataKey, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s extension: %w", name, err)
+			}
+			if msg.encryption == nil {
+				msg.encryption = &messageEncryption{}
+			}
+			msg.encryption.dataKey = dataKey
+		case "traceparent", "tracestate":
+			messageTraceCarrier{msg: msg}.Set(name, value)
+		default:
+			key := name
+			for header, extension := range cloudEventsHeaderExtensions {
+				if extension == name {
+					key = header
+				}
+			}
+			WithHeader(key, value)(msg)
+		}
+	}
+	return msg, nil
+}
+
+func (e *cloudEvent) isJSON() bool {
+	mediaType, _, err := mime.ParseMediaType(e.DataContentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func (e *cloudEvent) MarshalJSON() ([]byte, error) {
+	encoded := map[string]any{
+		"specversion": cloudEventsSpecVersion,
+		"id":          e.ID,
+		"source":      e.Source,
+		"type":        e.Type,
+	}
+	if e.Subject != "" {
+		encoded["subject"] = e.Subject
+	}
+	if !e.Time.IsZero() {
+		encoded["time"] = e.Time.Format(time.RFC3339Nano)
+	}
+	if e.DataContentType != "" {
+		encoded["datacontenttype"] = e.DataContentType
+	}
+	if len(e.Data) > 0 {
+		if e.isJSON() && json.Valid(e.Data) {
+			encoded["data"] = json.RawMessage(e.Data)
+		} else {
+			encoded["data_base64"] = e.Data
+		}
+	}
+	for name, value := range e.Extensions {
+		encoded[name] = value
+	}
+	return json.Marshal(encoded)
+}
+
+func (e *cloudEvent) UnmarshalJSON(data []byte) error {
+	encoded := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	var specVersion string
+	if err := json.Unmarshal(encoded["specversion"], &specVersion); err != nil || specVersion != cloudEventsSpecVersion {
+		return fmt.Errorf("unsupported CloudEvents spec version: %s", string(encoded["specversion"]))
+	}
+	for name, target := range map[string]*string{
+		"id":              &e.ID,
+		"source":          &e.Source,
+		"type":            &e.Type,
+		"subject":         &e.Subject,
+		"datacontenttype": &e.DataContentType,
+	} {
+		if value, ok := encoded[name]; ok {
+			if err := json.Unmarshal(value, target); err != nil {
+				return fmt.Errorf("invalid %s attribute: %w", name, err)
+			}
+		}
+	}
+	if value, ok := encoded["time"]; ok {
+		if err := json.Unmarshal(value, &e.Time); err != nil {
+			return fmt.Errorf("invalid time attribute: %w", err)
+		}
+	}
+	if value, ok := encoded["data_base64"]; ok {
+		if err := json.Unmarshal(value, &e.Data); err != nil {
+			return fmt.Errorf("invalid data_base64 attribute: %w", err)
+		}
+	} else if value, ok := encoded["data"]; ok {
+		if e.DataContentType == "" || e.isJSON() {
+			e.Data = value
+		} else {
+			// the data of a non-JSON content type is encoded as a JSON string
+			var data string
+			if err := json.Unmarshal(value, &data); err != nil {
+				return fmt.Errorf("invalid data attribute: %w", err)
+			}
+			e.Data = []byte(data)
+		}
+	}
+	e.Extensions = map[string]string{}
+	for name, value := range encoded {
+		if isCloudEventsReservedName(name) {
+			continue
+		}
+		// the extensions can be strings, numbers or booleans, but they are all kept as strings
+		var extension any
+		if err := json.Unmarshal(value, &extension); err != nil {
+			return fmt.Errorf("invalid %s extension: %w", name, err)
+		}
+		if s, ok := extension.(string); ok {
+			e.Extensions[name] = s
+		} else {
+			e.Extensions[name] = string(value)
+		}
+	}
+	return nil
+}
+
+func isCloudEventsReservedName(name string) bool {
+	for _, attribute := range cloudEventsContextAttributes {
+		if attribute == name {
+			return true
+		}
+	}
+	return false
+}
+
+// encoding and decoding HTTP requests
+// ---
+
+// newCloudEventsRequests encodes the batch of messages as one or more requests, depending on the mode
+func newCloudEventsRequests(endpoint string, mode CloudEventsMode, batch []*Message) ([]*http.Request, error) {
+	events := make([]*cloudEvent, len(batch))
+	for i, msg := range batch {
+		event, err := newCloudEvent(msg)
+		if err != nil {
+			return nil, err
+		}
+		events[i] = event
+	}
+	newRequest := func(contentType string, body []byte) (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		return req, nil
+	}
+	switch mode {
+	case CloudEventsBatched:
+		body, err := json.Marshal(events)
+		if err != nil {
+			return nil, err
+		}
+		req, err := newRequest(cloudEventsBatchedType, body)
+		if err != nil {
+			return nil, err
+		}
+		return []*http.Request{req}, nil
+	case CloudEventsStructured:
+		requests := make([]*http.Request, len(events))
+		for i, event := range events {
+			body, err := json.Marshal(event)
+			if err != nil {
+				return nil, err
+			}
+			if requests[i], err = newRequest(cloudEventsStructuredType, body); err != nil {
+				return nil, err
+			}
+		}
+		return requests, nil
+	case CloudEventsBinary:
+		requests := make([]*http.Request, len(events))
+		for i, event := range events {
+			req, err := newRequest(event.DataContentType, event.Data)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("ce-specversion", cloudEventsSpecVersion)
+			req.Header.Set("ce-id", event.ID)
+			req.Header.Set("ce-source", event.Source)
+			req.Header.Set("ce-type", event.Type)
+			if event.Subject != "" {
+				req.Header.Set("ce-subject", event.Subject)
+			}
+			req.Header.Set("ce-time", event.Time.Format(time.RFC3339Nano))
+			for name, value := range event.Extensions {
+				req.Header.Set("ce-"+name, value)
+			}
+			requests[i] = req
+		}
+		return requests, nil
+	}
+	return nil, fmt.Errorf("unknown CloudEvents mode: %d", mode)
+}
+
+// isCloudEventsRequest checks if the request carries CloudEvents in any of the modes
+func isCloudEventsRequest(r *http.Request) bool {
+	if r.Header.Get("ce-specversion") != "" {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == cloudEventsStructuredType || mediaType == cloudEventsBatchedType
+}
+
+// decodeCloudEventsRequest decodes the messages from a request in any of the modes
+func decodeCloudEventsRequest(r *http.Request) ([]*Message, error) {
+	events := []*cloudEvent{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == cloudEventsBatchedType:
+		if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+			return nil, err
+		}
+	case mediaType == cloudEventsStructuredType:
+		event := &cloudEvent{}
+		if err := json.NewDecoder(r.Body).Decode(event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	default:
+		if specVersion := r.Header.Get("ce-specversion"); specVersion != cloudEventsSpecVersion {
+			return nil, fmt.Errorf("unsupported CloudEvents spec version: %s", specVersion)
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		event := &cloudEvent{
+			ID:              r.Header.Get("ce-id"),
+			Source:          r.Header.Get("ce-source"),
+			Type:            r.Header.Get("ce-type"),
+			Subject:         r.Header.Get("ce-subject"),
+			DataContentType: r.Header.Get("Content-Type"),
+			Data:            data,
+			Extensions:      map[string]string{},
+		}
+		if value := r.Header.Get("ce-time"); value != "" {
+			if event.Time, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				return nil, fmt.Errorf("invalid time attribute: %w", err)
+			}
+		}
+		for key := range r.Header {
+			name := strings.ToLower(key)
+			if !strings.HasPrefix(name, "ce-") {
+				continue
+			}
+			name = strings.TrimPrefix(name, "ce-")
+			if isCloudEventsReservedName(name) {
+				continue
+			}
+			event.Extensions[name] = r.Header.Get(key)
+		}
+		events = append(events, event)
+	}
+	batch := make([]*Message, len(events))
+	for i, event := range events {
+		msg, err := event.toMessage()
+		if err != nil {
+			return nil, err
+		}
+		batch[i] = msg
+	}
+	return batch, nil
+}
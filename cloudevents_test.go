@@ -0,0 +1,205 @@
+package opinionatedevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCloudEvents(t *testing.T) {
+	t.Run("maps the message fields to the attributes", func(t *testing.T) {
+		deliverAt := time.Now().Add(time.Hour)
+		msg, err := NewMessage("customers.created", &testMessagePayload{Value: "42"},
+			WithDeliverAt(deliverAt),
+			WithCorrelationID("request-1"),
+			WithHeader("tenant", "acme"),
+		)
+		assert.NoError(t, err)
+		client := &testHTTPClient{}
+		client.pushHandler(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "application/cloudevents+json", req.Header.Get("Content-Type"))
+			body, err := io.ReadAll(req.Body)
+			assert.NoError(t, err)
+			var event map[string]any
+			assert.NoError(t, json.Unmarshal(body, &event))
+			assert.Equal(t, map[string]any{
+				"specversion":     "1.0",
+				"id":              msg.GetUUID(),
+				"type":            "customers.created",
+				"subject":         "customers",
+				"source":          "customers",
+				"time":            msg.GetPublishedAt().UTC().Format(time.RFC3339Nano),
+				"datacontenttype": "application/json",
+				"data":            map[string]any{"value": "42"},
+				"deliverat":       deliverAt.UTC().Format(time.RFC3339Nano),
+				"correlationid":   "request-1",
+				"tenant":          "acme",
+			}, event)
+			return &http.Response{StatusCode: http.StatusAccepted}, nil
+		})
+		destination := NewHTTPDestination("https://api.example.com/events",
+			HTTPDestinationWithCloudEvents(CloudEventsStructured),
+		)
+		destination.setClient(client)
+		assert.NoError(t, destination.Deliver(context.Background(), []*Message{msg}))
+	})
+
+	t.Run("fails if a header cannot be an extension", func(t *testing.T) {
+		msg, err := NewMessage("customers.created", nil, WithHeader("Tenant-ID", "acme"))
+		assert.NoError(t, err)
+		destination := NewHTTPDestination("https://api.example.com/events",
+			HTTPDestinationWithCloudEvents(CloudEventsBinary),
+		)
+		destination.setClient(&testHTTPClient{})
+		assert.ErrorContains(t, destination.Deliver(context.Background(), []*Message{msg}), "Tenant-ID")
+	})
+
+	t.Run("fails if a header uses the name of a message extension", func(t *testing.T) {
+		for _, name := range []string{
+			"priority", "partitionkey", "deliverat", "expiresat", "dataversion", "encryptionkeyid", "encryptiondatakey",
+			"traceparent", "correlationid",
+		} {
+			msg, err := NewMessage("customers.created", nil, WithHeader(name, "1"), WithPriority(10))
+			assert.NoError(t, err)
+			_, err = newCloudEvent(msg)
+			assert.ErrorContains(t, err, name)
+		}
+		// the headers which are renamed to the extensions are still allowed
+		msg, err := NewMessage("customers.created", nil, WithCorrelationID("request-1"))
+		assert.NoError(t, err)
+		_, err = newCloudEvent(msg)
+		assert.NoError(t, err)
+	})
+
+	t.Run("sets the subject in binary mode", func(t *testing.T) {
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		requests, err := newCloudEventsRequests("https://api.example.com/events", CloudEventsBinary, []*Message{msg})
+		assert.NoError(t, err)
+		assert.Equal(t, "customers", requests[0].Header.Get("ce-subject"))
+		received, err := decodeCloudEventsRequest(requests[0])
+		assert.NoError(t, err)
+		assert.Equal(t, "customers.created", received[0].GetName())
+	})
+
+	for _, tc := range []struct {
+		name     string
+		mode     CloudEventsMode
+		requests int
+	}{
+		{name: "structured", mode: CloudEventsStructured, requests: 2},
+		{name: "batched", mode: CloudEventsBatched, requests: 1},
+		{name: "binary", mode: CloudEventsBinary, requests: 2},
+	} {
+		t.Run("round-trips a batch in "+tc.name+" mode", func(t *testing.T) {
+			source, err := NewHTTPSource(HTTPSourceWithQueue("local"))
+			assert.NoError(t, err)
+			receiver, err := NewReceiver(ReceiverWithSource(source))
+			assert.NoError(t, err)
+			received := []*Message{}
+			assert.NoError(t, receiver.On("local", "customers.created", func(_ context.Context, delivery Delivery) error {
+				received = append(received, delivery.GetMessage())
+				return nil
+			}))
+			assert.NoError(t, receiver.Start(context.Background()))
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests += 1
+				source.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+			destination := NewHTTPDestination(server.URL, HTTPDestinationWithCloudEvents(tc.mode))
+			msg1, err := NewMessage("customers.created", &testMessagePayload{Value: "1"},
+				WithCausationID("cause"),
+				WithHeader("tenant", "acme"),
+				WithVersion(2),
+			)
+			assert.NoError(t, err)
+			msg2, err := NewMessage("customers.created", nil, WithDeliverAt(time.Now().Add(time.Minute)))
+			assert.NoError(t, err)
+			assert.NoError(t, destination.Deliver(context.Background(), []*Message{msg1, msg2}))
+			assert.Equal(t, tc.requests, requests)
+			assert.Len(t, received, 2)
+			for i, msg := range []*Message{msg1, msg2} {
+				assert.Equal(t, msg.GetUUID(), received[i].GetUUID())
+				assert.Equal(t, msg.GetName(), received[i].GetName())
+				assert.True(t, msg.GetPublishedAt().Equal(received[i].GetPublishedAt()))
+				assert.True(t, msg.GetDeliverAt().Equal(received[i].GetDeliverAt()))
+				assert.Equal(t, msg.GetHeaders(), received[i].GetHeaders())
+				assert.Equal(t, msg.GetContentType(), received[i].GetContentType())
+				assert.Equal(t, msg.GetVersion(), received[i].GetVersion())
+			}
+			payload := &testMessagePayload{}
+			assert.NoError(t, received[0].GetPayload(payload))
+			assert.Equal(t, "1", payload.Value)
+		})
+	}
+
+	for _, mode := range []CloudEventsMode{CloudEventsStructured, CloudEventsBinary} {
+		t.Run(fmt.Sprintf("round-trips a protobuf payload in mode %d", mode), func(t *testing.T) {
+			handled := make(chan *Message, 1)
+			handler := newTestHTTPSourceHandler(t, "customers.created", func(_ context.Context, delivery Delivery) error {
+				handled <- delivery.GetMessage()
+				return nil
+			})
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			destination := NewHTTPDestination(server.URL+"/_events/local", HTTPDestinationWithCloudEvents(mode))
+			msg, err := NewMessage("customers.created", wrapperspb.String("42"), WithCodec(ProtobufCodec))
+			assert.NoError(t, err)
+			assert.NoError(t, destination.Deliver(context.Background(), []*Message{msg}))
+			received := <-handled
+			assert.Equal(t, "application/protobuf", received.GetContentType())
+			payload := &wrapperspb.StringValue{}
+			assert.NoError(t, received.GetPayload(payload))
+			assert.Equal(t, "42", payload.GetValue())
+		})
+	}
+
+	t.Run("accepts a binary event from another producer", func(t *testing.T) {
+		handler := newTestHTTPSourceHandler(t, "com.example.created", func(_ context.Context, delivery Delivery) error {
+			msg := delivery.GetMessage()
+			assert.Equal(t, "A234-1234-1234", msg.GetUUID())
+			assert.Equal(t, "com", msg.GetTopic())
+			assert.Equal(t, "2018-04-05T17:31:00Z", msg.GetPublishedAt().UTC().Format(time.RFC3339))
+			assert.Equal(t, "value", msg.GetHeader("comexampleextension"))
+			payload := map[string]any{}
+			assert.NoError(t, msg.GetPayload(&payload))
+			assert.Equal(t, map[string]any{"hello": "world"}, payload)
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodPost, "/_events/local", bytes.NewBufferString(`{"hello":"world"}`))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		req.Header.Set("ce-specversion", "1.0")
+		req.Header.Set("ce-type", "com.example.created")
+		req.Header.Set("ce-source", "https://example.com/source")
+		req.Header.Set("ce-id", "A234-1234-1234")
+		req.Header.Set("ce-time", "2018-04-05T17:31:00Z")
+		req.Header.Set("ce-comexampleextension", "value")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("rejects an unsupported spec version", func(t *testing.T) {
+		handler := newTestHTTPSourceHandler(t, "customers.created", func(_ context.Context, _ Delivery) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodPost, "/_events/local",
+			bytes.NewBufferString(`{"specversion":"0.3","id":"1","type":"customers.created","source":"customers"}`),
+		)
+		req.Header.Set("Content-Type", "application/cloudevents+json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+}
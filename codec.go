@@ -0,0 +1,121 @@
+package opinionatedevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes and decodes the payloads of messages with a certain content type.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// the built-in codecs
+var (
+	// JSONCodec encodes the payloads with `encoding/json`, it is the default codec.
+	JSONCodec Codec = &jsonCodec{}
+	// ProtobufCodec encodes the payloads which implement `proto.Message` in the protobuf wire format.
+	ProtobufCodec Codec = &protobufCodec{}
+	// MsgpackCodec encodes the payloads in the MessagePack format.
+	MsgpackCodec Codec = &msgpackCodec{}
+)
+
+var (
+	codecs      = map[string]Codec{}
+	codecsMutex sync.RWMutex
+)
+
+func init() {
+	for _, codec := range []Codec{JSONCodec, ProtobufCodec, MsgpackCodec} {
+		RegisterCodec(codec)
+	}
+}
+
+// RegisterCodec makes a codec available for decoding the payloads of its content type. The built-in codecs are
+// registered by default, and registering a codec for the same content type replaces the previous one.
+func RegisterCodec(codec Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+	codecs[codec.ContentType()] = codec
+}
+
+func getCodec(contentType string) (Codec, error) {
+	// the parameters, e.g. the charset, do not affect which codec is used
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	codec, ok := codecs[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("no codec registered for content type %q", contentType)
+	}
+	return codec, nil
+}
+
+// json
+// ---
+
+type jsonCodec struct{}
+
+func (c *jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (c *jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c *jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// protobuf
+// ---
+
+type protobufCodec struct{}
+
+func (c *protobufCodec) ContentType() string {
+	return "application/protobuf"
+}
+
+func (c *protobufCodec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec cannot marshal %T, it does not implement proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (c *protobufCodec) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec cannot unmarshal into %T, it does not implement proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// msgpack
+// ---
+
+type msgpackCodec struct{}
+
+func (c *msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (c *msgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (c *msgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
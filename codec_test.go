@@ -0,0 +1,116 @@
+package opinionatedevents
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testCodecPayload struct {
+	Value string `json:"value" msgpack:"value"`
+}
+
+func TestCodecs(t *testing.T) {
+	t.Run("defaults to json", func(t *testing.T) {
+		msg, err := NewMessage("customers.created", &testCodecPayload{Value: "42"})
+		assert.NoError(t, err)
+		assert.Equal(t, "application/json", msg.GetContentType())
+		assert.JSONEq(t, `{"value":"42"}`, string(msg.payload))
+	})
+
+	t.Run("treats a message without a content type as json", func(t *testing.T) {
+		msg := &Message{}
+		assert.NoError(t, msg.UnmarshalJSON([]byte(
+			`{"name":"customers.created","meta":{"uuid":"1","published_at":"2024-01-01T00:00:00Z"},"payload":"eyJ2YWx1ZSI6IjQyIn0="}`,
+		)))
+		assert.Equal(t, "application/json", msg.GetContentType())
+		payload := &testCodecPayload{}
+		assert.NoError(t, msg.GetPayload(payload))
+		assert.Equal(t, "42", payload.Value)
+	})
+
+	for _, tc := range []struct {
+		name        string
+		codec       Codec
+		contentType string
+		payload     any
+		decoded     any
+		expected    any
+	}{
+		{
+			name:        "msgpack",
+			codec:       MsgpackCodec,
+			contentType: "application/msgpack",
+			payload:     &testCodecPayload{Value: "42"},
+			decoded:     &testCodecPayload{},
+			expected:    "42",
+		},
+		{
+			name:        "protobuf",
+			codec:       ProtobufCodec,
+			contentType: "application/protobuf",
+			payload:     wrapperspb.String("42"),
+			decoded:     &wrapperspb.StringValue{},
+			expected:    "42",
+		},
+	} {
+		t.Run("round-trips a "+tc.name+" payload", func(t *testing.T) {
+			msg, err := NewMessage("customers.created", tc.payload, WithCodec(tc.codec))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.contentType, msg.GetContentType())
+			data, err := json.Marshal(msg)
+			assert.NoError(t, err)
+			received := &Message{}
+			assert.NoError(t, json.Unmarshal(data, received))
+			assert.Equal(t, tc.contentType, received.GetContentType())
+			assert.NoError(t, received.GetPayload(tc.decoded))
+			switch decoded := tc.decoded.(type) {
+			case *testCodecPayload:
+				assert.Equal(t, tc.expected, decoded.Value)
+			case *wrapperspb.StringValue:
+				assert.Equal(t, tc.expected, decoded.GetValue())
+			}
+		})
+	}
+
+	t.Run("fails if the payload is not a protobuf message", func(t *testing.T) {
+		_, err := NewMessage("customers.created", &testCodecPayload{Value: "42"}, WithCodec(ProtobufCodec))
+		assert.ErrorContains(t, err, "proto.Message")
+	})
+
+	t.Run("fails if the codec is nil", func(t *testing.T) {
+		_, err := NewMessage("customers.created", &testCodecPayload{Value: "42"}, WithCodec(nil))
+		assert.ErrorContains(t, err, "codec cannot be nil")
+	})
+
+	t.Run("fails if no codec is registered for the content type", func(t *testing.T) {
+		msg := &Message{contentType: "application/x-unknown", payload: []byte("42")}
+		assert.ErrorContains(t, msg.GetPayload(&testCodecPayload{}), "no codec registered")
+	})
+
+	t.Run("uses a registered codec", func(t *testing.T) {
+		RegisterCodec(&testUpperCodec{})
+		msg := &Message{contentType: "text/x-upper; charset=utf-8", payload: []byte("hello")}
+		var payload string
+		assert.NoError(t, msg.GetPayload(&payload))
+		assert.Equal(t, "HELLO", payload)
+	})
+}
+
+type testUpperCodec struct{}
+
+func (c *testUpperCodec) ContentType() string {
+	return "text/x-upper"
+}
+
+func (c *testUpperCodec) Marshal(v any) ([]byte, error) {
+	return []byte(*v.(*string)), nil
+}
+
+func (c *testUpperCodec) Unmarshal(data []byte, v any) error {
+	*v.(*string) = strings.ToUpper(string(data))
+	return nil
+}
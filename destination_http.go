@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type httpClient interface {
@@ -13,22 +15,40 @@ type httpClient interface {
 }
 
 type httpDestination struct {
-	endpoint string
-	client   httpClient
+	endpoint    string
+	client      httpClient
+	cloudEvents CloudEventsMode
 }
 
-func NewHTTPDestination(endpoint string) *httpDestination {
-	return &httpDestination{
+type httpDestinationOption func(d *httpDestination)
+
+// HTTPDestinationWithCloudEvents encodes the messages as CloudEvents 1.0 in the given mode, instead of the native
+// format of this package.
+func HTTPDestinationWithCloudEvents(mode CloudEventsMode) httpDestinationOption {
+	return func(d *httpDestination) {
+		d.cloudEvents = mode
+	}
+}
+
+func NewHTTPDestination(endpoint string, options ...httpDestinationOption) *httpDestination {
+	destination := &httpDestination{
 		endpoint: endpoint,
 		client:   http.DefaultClient,
 	}
+	for _, apply := range options {
+		apply(destination)
+	}
+	return destination
 }
 
 func (d *httpDestination) setClient(client httpClient) {
 	d.client = client
 }
 
-func (d *httpDestination) Deliver(_ context.Context, batch []*Message) error {
+func (d *httpDestination) Deliver(ctx context.Context, batch []*Message) error {
+	if d.cloudEvents != 0 {
+		return d.deliverCloudEvents(ctx, batch)
+	}
 	payload, err := json.Marshal(batch)
 	if err != nil {
 		return err
@@ -39,13 +59,61 @@ func (d *httpDestination) Deliver(_ context.Context, batch []*Message) error {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	injectHTTPTraceContext(ctx, req.Header)
 	// make the request
 	resp, err := d.client.Do(req)
 	if err != nil {
 		return err
 	}
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("endpoint returned a non-200 status code: %d", resp.StatusCode)
+		return httpResponseError(resp, fmt.Errorf("endpoint returned a non-200 status code: %d", resp.StatusCode))
 	}
 	return nil
 }
+
+func (d *httpDestination) deliverCloudEvents(ctx context.Context, batch []*Message) error {
+	requests, err := newCloudEventsRequests(d.endpoint, d.cloudEvents, batch)
+	if err != nil {
+		return err
+	}
+	// NOTE: in the structured and binary modes, a failure in the middle of the batch delivers the batch again
+	for _, req := range requests {
+		injectHTTPTraceContext(ctx, req.Header)
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.Body != nil {
+			resp.Body.Close()
+		}
+		// CloudEvents receivers commonly respond with e.g. 202 Accepted
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return httpResponseError(resp, fmt.Errorf("endpoint returned a non-2xx status code: %d", resp.StatusCode))
+		}
+	}
+	return nil
+}
+
+// httpResponseError maps a failed response to the kind of its error: the client errors (e.g. `422` for a dropped
+// message) are fatal as sending the batch again would not help, and a `Retry-After` header sets when to retry
+func httpResponseError(resp *http.Response, err error) error {
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Fatal(err)
+	}
+	retryAfter := resp.Header.Get("Retry-After")
+	if retryAfter == "" {
+		return err
+	}
+	// the header is either a number of seconds or an HTTP date
+	if seconds, parseErr := strconv.Atoi(retryAfter); parseErr == nil {
+		return &retryError{retryAt: time.Now().Add(time.Duration(seconds) * time.Second), err: err}
+	}
+	if retryAt, parseErr := http.ParseTime(retryAfter); parseErr == nil {
+		return &retryError{retryAt: retryAt, err: err}
+	}
+	return err
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -119,6 +122,54 @@ func TestHTTPDestination(t *testing.T) {
 	})
 }
 
+func TestHTTPDestinationToHTTPSource(t *testing.T) {
+	newTestServer := func(t *testing.T, onMessage OnMessageHandler) *httpDestination {
+		server := httptest.NewServer(newTestHTTPSourceHandler(t, "customers.created", onMessage))
+		t.Cleanup(server.Close)
+		return NewHTTPDestination(server.URL + "/_events/local")
+	}
+
+	t.Run("delivers a message", func(t *testing.T) {
+		destination := newTestServer(t, func(_ context.Context, _ Delivery) error {
+			return nil
+		})
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, destination.Deliver(context.Background(), []*Message{msg}))
+	})
+
+	t.Run("does not retry a dropped message", func(t *testing.T) {
+		var attempts atomic.Int32
+		destination := newTestServer(t, func(_ context.Context, _ Delivery) error {
+			attempts.Add(1)
+			return Fatal(errors.New("just a test"))
+		})
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		err = destination.Deliver(context.Background(), []*Message{msg})
+		assert.True(t, IsFatal(err))
+		// the async bridge gives up on the first attempt
+		envelope := newAsyncBridge(3, 0, destination).take(context.Background(), []*Message{msg})
+		assert.Error(t, waitForSuccessEnvelope(envelope))
+		assert.Equal(t, int32(2), attempts.Load())
+	})
+
+	t.Run("retries a message after the time from the source", func(t *testing.T) {
+		destination := newTestServer(t,
+			WithBackoff(ConstantBackoff(10*time.Second))(func(_ context.Context, _ Delivery) error {
+				return errors.New("just a test")
+			}),
+		)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		err = destination.Deliver(context.Background(), []*Message{msg})
+		assert.False(t, IsFatal(err))
+		var retryErr *retryError
+		assert.ErrorAs(t, err, &retryErr)
+		assert.WithinDuration(t, time.Now().Add(10*time.Second), retryErr.retryAt, 2*time.Second)
+	})
+}
+
 type testHTTPClientPayload struct{}
 
 func (p *testHTTPClientPayload) MarshalJSON() ([]byte, error) {
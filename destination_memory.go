@@ -0,0 +1,41 @@
+package opinionatedevents
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type memoryDestination struct {
+	bus *memoryBus
+}
+
+func NewMemoryDestination(bus *memoryBus) *memoryDestination {
+	return &memoryDestination{bus: bus}
+}
+
+func (d *memoryDestination) Deliver(_ context.Context, batch []*Message) error {
+	toBeInserted := []*memoryEvent{}
+	for _, msg := range batch {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		for _, queue := range d.bus.queues(msg.GetTopic()) {
+			toBeInserted = append(toBeInserted, &memoryEvent{
+				uuid:        msg.GetUUID(),
+				publishedAt: msg.GetPublishedAt(),
+				topic:       msg.GetTopic(),
+				queue:       queue,
+				name:        msg.GetName(),
+				orderingKey: msg.GetOrderingKey(),
+				priority:    msg.GetPriority(),
+				status:      "pending",
+				deliverAt:   msg.GetDeliverAt(),
+				expiresAt:   msg.GetExpiresAt(),
+				payload:     payload,
+			})
+		}
+	}
+	d.bus.insert(toBeInserted...)
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -146,6 +148,7 @@ func (p *postgresTransactionProvider) do(ctx context.Context, action func(tx sql
 
 type postgresDestination struct {
 	db             sqlDB
+	logger         *slog.Logger
 	routing        postgresRoutingProvider
 	schema         string
 	skipMigrations bool
@@ -162,6 +165,18 @@ func PostgresDestinationWithSchema(schema string) postgresDestinationOption {
 	}
 }
 
+// PostgresDestinationWithLogger sets the logger used by the destination and its migrations, defaults to
+// `slog.Default()`.
+func PostgresDestinationWithLogger(logger *slog.Logger) postgresDestinationOption {
+	return func(d *postgresDestination) error {
+		if logger == nil {
+			return errors.New("logger cannot be nil")
+		}
+		d.logger = logger
+		return nil
+	}
+}
+
 func NewPostgresDestination(db *sql.DB, options ...postgresDestinationOption) (*postgresDestination, error) {
 	// init the dependencies
 	_db := &realDB{db: db}
@@ -169,6 +184,7 @@ func NewPostgresDestination(db *sql.DB, options ...postgresDestinationOption) (*
 	defaultSchema := "opinionatedevents"
 	destination := &postgresDestination{
 		db:             _db,
+		logger:         slog.Default(),
 		routing:        newPersistedPostgresRoutingProvider(defaultSchema),
 		schema:         defaultSchema,
 		skipMigrations: false,
@@ -181,7 +197,7 @@ func NewPostgresDestination(db *sql.DB, options ...postgresDestinationOption) (*
 	}
 	// make sure the migrations are run
 	if !destination.skipMigrations {
-		if err := migrate(db, destination.schema); err != nil {
+		if err := migrate(db, destination.schema, destination.logger); err != nil {
 			return nil, err
 		}
 	}
@@ -210,15 +226,26 @@ func (d *postgresDestination) Deliver(ctx context.Context, batch []*Message) err
 			if err != nil {
 				return err
 			}
+			if len(queues) == 0 {
+				d.logger.DebugContext(ctx, "no queues declared for the topic of the message",
+					append(messageLogAttrs(msg), "topic", msg.GetTopic())...,
+				)
+			}
 			for _, queue := range queues {
 				toBeInserted = append(toBeInserted, &postgresDestinationInsertMessage{
-					name:        msg.GetName(),
-					payload:     payload,
-					publishedAt: msg.GetPublishedAt(),
-					deliverAt:   msg.GetDeliverAt(),
-					queue:       queue,
-					topic:       msg.GetTopic(),
-					uuid:        msg.GetUUID(),
+					causationID:   msg.GetCausationID(),
+					contentType:   msg.GetContentType(),
+					correlationID: msg.GetCorrelationID(),
+					name:          msg.GetName(),
+					orderingKey:   msg.GetOrderingKey(),
+					payload:       payload,
+					priority:      msg.GetPriority(),
+					publishedAt:   msg.GetPublishedAt(),
+					deliverAt:     msg.GetDeliverAt(),
+					expiresAt:     msg.GetExpiresAt(),
+					queue:         queue,
+					topic:         msg.GetTopic(),
+					uuid:          msg.GetUUID(),
 				})
 
 			}
@@ -228,13 +255,19 @@ func (d *postgresDestination) Deliver(ctx context.Context, batch []*Message) err
 }
 
 type postgresDestinationInsertMessage struct {
-	deliverAt   time.Time
-	name        string
-	payload     []byte
-	publishedAt time.Time
-	queue       string
-	topic       string
-	uuid        string
+	causationID   string
+	contentType   string
+	correlationID string
+	deliverAt     time.Time
+	expiresAt     time.Time
+	name          string
+	orderingKey   string
+	payload       []byte
+	priority      int
+	publishedAt   time.Time
+	queue         string
+	topic         string
+	uuid          string
 }
 
 func (d *postgresDestination) insertMessages(tx sqlTx, messages ...*postgresDestinationInsertMessage) error {
@@ -249,7 +282,7 @@ func (d *postgresDestination) insertMessages(tx sqlTx, messages ...*postgresDest
 		var values = []string{}
 		for _, i := range batch {
 			values = append(values,
-				fmt.Sprintf("('pending', %s, %s, %s, %s, %s, %s, %s)",
+				fmt.Sprintf("('pending', %s, %s, %s, %s, %s, %s, %s, NULLIF(%s, ''), NULLIF(%s, ''), %s, NULLIF(%s, ''), %s, %s)",
 					asParam(i.topic),
 					asParam(i.queue),
 					asParam(i.publishedAt.UTC()),
@@ -257,12 +290,21 @@ func (d *postgresDestination) insertMessages(tx sqlTx, messages ...*postgresDest
 					asParam(i.uuid),
 					asParam(i.name),
 					asParam(i.payload),
+					asParam(i.correlationID),
+					asParam(i.causationID),
+					asParam(i.contentType),
+					asParam(i.orderingKey),
+					asParam(i.priority),
+					asParam(sql.NullTime{Time: i.expiresAt.UTC(), Valid: !i.expiresAt.IsZero()}),
 				),
 			)
 		}
 		// define the needed SQL queries
 		var insertQueryTemplate = `
-		INSERT INTO :SCHEMA.events (status, topic, queue, published_at, deliver_at, uuid, name, payload)
+		INSERT INTO :SCHEMA.events (
+			status, topic, queue, published_at, deliver_at, uuid, name, payload, correlation_id, causation_id,
+			content_type, ordering_key, priority, expires_at
+		)
 		VALUES %s
 		ON CONFLICT (queue, uuid) DO NOTHING
 		`
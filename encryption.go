@@ -0,0 +1,154 @@
+package opinionatedevents
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// KeyProvider provides the keys for encrypting the payloads. The keys are identified by ids, so that a new key can be
+// taken into use while the payloads encrypted with the older keys remain decryptable.
+type KeyProvider interface {
+	// CurrentKey returns the id and the key used for encrypting the new payloads.
+	CurrentKey(ctx context.Context) (string, []byte, error)
+	// Key returns the key with the given id for decrypting a payload.
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// ErrUnknownKey is returned (wrapped) by the key providers when a key does not exist.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+type staticKeyProvider struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+// NewStaticKeyProvider returns a key provider for a fixed set of AES keys (16, 24 or 32 bytes), keyed by their ids.
+// The keys are rotated by adding a new key, making it the current one, and keeping the old keys for decrypting.
+func NewStaticKeyProvider(currentID string, keys map[string][]byte) (*staticKeyProvider, error) {
+	if _, ok := keys[currentID]; !ok {
+		return nil, fmt.Errorf(`current key "%s" does not exist`, currentID)
+	}
+	for id, key := range keys {
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf(`invalid key "%s": %w`, id, err)
+		}
+	}
+	return &staticKeyProvider{currentID: currentID, keys: keys}, nil
+}
+
+func (p *staticKeyProvider) CurrentKey(_ context.Context) (string, []byte, error) {
+	return p.currentID, p.keys[p.currentID], nil
+}
+
+func (p *staticKeyProvider) Key(_ context.Context, id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf(`%w: "%s"`, ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// envelope encryption
+// ---
+
+// messageEncryption describes how the payload of a message was encrypted: every payload is encrypted with its own
+// random data key, which is in turn encrypted with a key of the key provider
+type messageEncryption struct {
+	keyID   string
+	dataKey []byte
+}
+
+const dataKeySize int = 32
+
+// encryptMessage returns a copy of the message with its payload encrypted
+func encryptMessage(ctx context.Context, keys KeyProvider, msg *Message) (*Message, error) {
+	if msg.encryption != nil {
+		return msg, nil
+	}
+	keyID, key, err := keys.CurrentKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	encryptedDataKey, err := sealAESGCM(key, dataKey, []byte(keyID))
+	if err != nil {
+		return nil, err
+	}
+	// the payload is bound to the message so that it cannot be swapped with the payload of another message
+	payload, err := sealAESGCM(dataKey, msg.payload, encryptionAdditionalData(msg))
+	if err != nil {
+		return nil, err
+	}
+	encrypted := *msg
+	encrypted.payload = payload
+	encrypted.encryption = &messageEncryption{keyID: keyID, dataKey: encryptedDataKey}
+	return &encrypted, nil
+}
+
+// decryptMessage returns a copy of the message with its payload decrypted, the failures to get the key are returned
+// as is while the ciphertexts which cannot be decrypted are fatal
+func decryptMessage(ctx context.Context, keys KeyProvider, msg *Message) (*Message, error) {
+	if msg.encryption == nil {
+		return msg, nil
+	}
+	key, err := keys.Key(ctx, msg.encryption.keyID)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := openAESGCM(key, msg.encryption.dataKey, []byte(msg.encryption.keyID))
+	if err != nil {
+		return nil, Fatal(fmt.Errorf("failed to decrypt the data key: %w", err))
+	}
+	payload, err := openAESGCM(dataKey, msg.payload, encryptionAdditionalData(msg))
+	if err != nil {
+		return nil, Fatal(fmt.Errorf("failed to decrypt the payload: %w", err))
+	}
+	decrypted := *msg
+	decrypted.payload = payload
+	decrypted.encryption = nil
+	return &decrypted, nil
+}
+
+func encryptionAdditionalData(msg *Message) []byte {
+	return []byte(msg.GetUUID() + "/" + msg.GetName())
+}
+
+// sealAESGCM encrypts the plaintext with AES-GCM, the random nonce is prepended to the ciphertext
+func sealAESGCM(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openAESGCM(key []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
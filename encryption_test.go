@@ -0,0 +1,123 @@
+package opinionatedevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func publishTestEncryptedMessage(t *testing.T, keys KeyProvider, payload any) *Message {
+	var published *Message
+	destination := newTestDestination()
+	destination.pushHandler(func(_ context.Context, batch []*Message) error {
+		// the message goes through its JSON envelope as it would with any real destination
+		data, err := json.Marshal(batch[0])
+		assert.NoError(t, err)
+		published = &Message{}
+		return json.Unmarshal(data, published)
+	})
+	publisher, err := NewPublisher(PublisherWithSyncBridge(destination), PublisherWithEncryption(keys))
+	assert.NoError(t, err)
+	msg, err := NewMessage("customers.created", payload)
+	assert.NoError(t, err)
+	assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+	// the message given to the publisher is left as is
+	assert.Nil(t, msg.encryption)
+	return published
+}
+
+func TestEncryption(t *testing.T) {
+	key1, key2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+
+	t.Run("encrypts the payload before it reaches the destination", func(t *testing.T) {
+		keys, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": key1})
+		assert.NoError(t, err)
+		published := publishTestEncryptedMessage(t, keys, map[string]any{"email": "jane@example.com"})
+		assert.NotContains(t, string(published.payload), "jane@example.com")
+		assert.Equal(t, "v1", published.encryption.keyID)
+		assert.ErrorContains(t, published.GetPayload(&map[string]any{}), "encrypted")
+	})
+
+	t.Run("decrypts the payloads of the old keys after a rotation", func(t *testing.T) {
+		oldKeys, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": key1})
+		assert.NoError(t, err)
+		newKeys, err := NewStaticKeyProvider("v2", map[string][]byte{"v1": key1, "v2": key2})
+		assert.NoError(t, err)
+		receiver, err := NewReceiver(ReceiverWithEncryption(newKeys))
+		assert.NoError(t, err)
+		received := []string{}
+		assert.NoError(t, receiver.On("default", "customers.created", func(_ context.Context, delivery Delivery) error {
+			payload := map[string]string{}
+			assert.NoError(t, delivery.GetMessage().GetPayload(&payload))
+			received = append(received, payload["email"])
+			return nil
+		}))
+		assert.NoError(t, receiver.Start(context.Background()))
+		old := publishTestEncryptedMessage(t, oldKeys, map[string]any{"email": "old@example.com"})
+		assert.Equal(t, "v1", old.encryption.keyID)
+		rotated := publishTestEncryptedMessage(t, newKeys, map[string]any{"email": "new@example.com"})
+		assert.Equal(t, "v2", rotated.encryption.keyID)
+		assert.NoError(t, receiver.Deliver(context.Background(), &testDelivery{1, "default", old}))
+		assert.NoError(t, receiver.Deliver(context.Background(), &testDelivery{1, "default", rotated}))
+		assert.Equal(t, []string{"old@example.com", "new@example.com"}, received)
+	})
+
+	t.Run("retries a message with an unknown key", func(t *testing.T) {
+		keys, err := NewStaticKeyProvider("v2", map[string][]byte{"v2": key2})
+		assert.NoError(t, err)
+		otherKeys, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": key1})
+		assert.NoError(t, err)
+		receiver, err := NewReceiver(ReceiverWithEncryption(keys))
+		assert.NoError(t, err)
+		assert.NoError(t, receiver.On("default", "customers.created", func(_ context.Context, _ Delivery) error {
+			return nil
+		}))
+		assert.NoError(t, receiver.Start(context.Background()))
+		msg := publishTestEncryptedMessage(t, otherKeys, nil)
+		err = receiver.Deliver(context.Background(), &testDelivery{1, "default", msg})
+		assert.ErrorIs(t, err, ErrUnknownKey)
+		assert.False(t, IsFatal(err))
+	})
+
+	t.Run("drops a message which has been tampered with", func(t *testing.T) {
+		keys, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": key1})
+		assert.NoError(t, err)
+		receiver, err := NewReceiver(ReceiverWithEncryption(keys))
+		assert.NoError(t, err)
+		assert.NoError(t, receiver.On("default", "customers.created", func(_ context.Context, _ Delivery) error {
+			return nil
+		}))
+		assert.NoError(t, receiver.Start(context.Background()))
+		msg := publishTestEncryptedMessage(t, keys, map[string]any{"email": "jane@example.com"})
+		msg.payload[len(msg.payload)-1] ^= 1
+		assert.True(t, IsFatal(receiver.Deliver(context.Background(), &testDelivery{1, "default", msg})))
+	})
+
+	t.Run("carries the encryption over cloudevents", func(t *testing.T) {
+		keys, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": key1})
+		assert.NoError(t, err)
+		msg := publishTestEncryptedMessage(t, keys, map[string]any{"email": "jane@example.com"})
+		event, err := newCloudEvent(msg)
+		assert.NoError(t, err)
+		data, err := json.Marshal(event)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(data), "jane@example.com")
+		decoded := &cloudEvent{}
+		assert.NoError(t, json.Unmarshal(data, decoded))
+		received, err := decoded.toMessage()
+		assert.NoError(t, err)
+		decrypted, err := decryptMessage(context.Background(), keys, received)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"email":"jane@example.com"}`, string(decrypted.payload))
+	})
+
+	t.Run("rejects invalid keys", func(t *testing.T) {
+		_, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": []byte("too short")})
+		assert.Error(t, err)
+		_, err = NewStaticKeyProvider("v2", map[string][]byte{"v1": key1})
+		assert.Error(t, err)
+	})
+}
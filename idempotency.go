@@ -0,0 +1,153 @@
+package opinionatedevents
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// IdempotencyStore keeps track of the keys of the messages which are being handled or have been handled successfully.
+type IdempotencyStore interface {
+	// Claim claims the key for the queue while its delivery is being handled. It returns false if the key has already
+	// been recorded (and has not expired yet), or `ErrIdempotencyKeyClaimed` if another delivery is handling it.
+	Claim(ctx context.Context, queue string, key string) (bool, error)
+	// Record records the claimed key for the queue after its delivery was handled successfully.
+	Record(ctx context.Context, queue string, key string) error
+	// Release releases the claimed key for the queue after its delivery failed, so that it can be retried.
+	Release(ctx context.Context, queue string, key string) error
+}
+
+// ErrIdempotencyKeyClaimed is returned by the stores when the key is claimed by a delivery which is still being handled.
+var ErrIdempotencyKeyClaimed = errors.New("idempotency key is claimed by another delivery")
+
+type idempotency struct {
+	key func(delivery Delivery) string
+}
+
+type idempotencyOption func(i *idempotency)
+
+// IdempotencyWithKey sets how the key of a delivery is extracted, defaults to the uuid of the message. A custom key
+// can be used for skipping the messages which are duplicates by their content, e.g. a header set by the publisher.
+func IdempotencyWithKey(key func(delivery Delivery) string) idempotencyOption {
+	return func(i *idempotency) {
+		i.key = key
+	}
+}
+
+// WithIdempotency skips the deliveries whose key has already been handled successfully on the same queue, reporting
+// them as successful. The key is claimed before the handler runs so that concurrent duplicates are not handled twice,
+// instead they are retried until the first one has either succeeded or failed. With
+// `PostgresSourceWithTransactionalHandlers` and a Postgres store, the key is claimed and recorded within the
+// transaction of the handler.
+func WithIdempotency(store IdempotencyStore, options ...idempotencyOption) OnMessageMiddleware {
+	i := &idempotency{
+		key: func(delivery Delivery) string {
+			return delivery.GetMessage().GetUUID()
+		},
+	}
+	for _, apply := range options {
+		apply(i)
+	}
+	return func(next OnMessageHandler) OnMessageHandler {
+		return func(ctx context.Context, delivery Delivery) error {
+			queue, key := delivery.GetQueue(), i.key(delivery)
+			claimed, err := store.Claim(ctx, queue, key)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				return nil
+			}
+			// the context of the handler may already be done once it returns (e.g. it timed out), but the claim must
+			// still be released or recorded, within a transaction the outcome follows the transaction instead
+			storeCtx := ctx
+			if _, ok := TxFromContext(ctx); !ok {
+				storeCtx = context.WithoutCancel(ctx)
+			}
+			if err := next(ctx, delivery); err != nil {
+				// NOTE: a claim which cannot be released is taken over once it expires (see the stores)
+				store.Release(storeCtx, queue, key) //nolint the error of the handler is the relevant one
+				return err
+			}
+			// NOTE: if recording fails, the message is retried and the handler may run again
+			return store.Record(storeCtx, queue, key)
+		}
+	}
+}
+
+// memory store
+// ---
+
+type memoryIdempotencyKey struct {
+	queue string
+	key   string
+}
+
+type memoryIdempotencyEntry struct {
+	claimed   bool
+	expiresAt time.Time
+}
+
+type memoryIdempotencyStore struct {
+	mutex     sync.Mutex
+	ttl       time.Duration
+	keys      map[memoryIdempotencyKey]memoryIdempotencyEntry
+	removedAt time.Time
+}
+
+// NewMemoryIdempotencyStore returns a store which keeps the keys in memory for the given duration, or forever if the
+// duration is zero.
+func NewMemoryIdempotencyStore(ttl time.Duration) (*memoryIdempotencyStore, error) {
+	if ttl < 0 {
+		return nil, errors.New("ttl must not be negative")
+	}
+	return &memoryIdempotencyStore{ttl: ttl, keys: map[memoryIdempotencyKey]memoryIdempotencyEntry{}}, nil
+}
+
+func (s *memoryIdempotencyStore) Claim(_ context.Context, queue string, key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	k := memoryIdempotencyKey{queue: queue, key: key}
+	if entry, ok := s.keys[k]; ok {
+		if entry.claimed {
+			return false, ErrIdempotencyKeyClaimed
+		}
+		if entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt) {
+			return false, nil
+		}
+	}
+	s.keys[k] = memoryIdempotencyEntry{claimed: true}
+	return true, nil
+}
+
+func (s *memoryIdempotencyStore) Record(_ context.Context, queue string, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	var expiresAt time.Time
+	if s.ttl > 0 {
+		expiresAt = now.Add(s.ttl)
+		// remove the expired keys at most once per ttl so that the store does not grow forever
+		if now.Sub(s.removedAt) >= s.ttl {
+			for k, entry := range s.keys {
+				if !entry.claimed && !now.Before(entry.expiresAt) {
+					delete(s.keys, k)
+				}
+			}
+			s.removedAt = now
+		}
+	}
+	s.keys[memoryIdempotencyKey{queue: queue, key: key}] = memoryIdempotencyEntry{expiresAt: expiresAt}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, queue string, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	k := memoryIdempotencyKey{queue: queue, key: key}
+	if entry, ok := s.keys[k]; ok && entry.claimed {
+		delete(s.keys, k)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package opinionatedevents
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type postgresIdempotencyStore struct {
+	db             *sql.DB
+	logger         *slog.Logger
+	schema         string
+	skipMigrations bool
+	ttl            time.Duration
+	claimTimeout   time.Duration
+	// the expired keys are removed at most once per interval
+	removeInterval time.Duration
+	removedAt      time.Time
+	removedAtMutex sync.Mutex
+}
+
+type postgresIdempotencyStoreOption func(s *postgresIdempotencyStore) error
+
+func PostgresIdempotencyStoreWithSchema(schema string) postgresIdempotencyStoreOption {
+	return func(s *postgresIdempotencyStore) error {
+		s.schema = schema
+		return nil
+	}
+}
+
+// PostgresIdempotencyStoreWithTTL sets for how long the keys are kept, defaults to forever.
+func PostgresIdempotencyStoreWithTTL(ttl time.Duration) postgresIdempotencyStoreOption {
+	return func(s *postgresIdempotencyStore) error {
+		if ttl <= 0 {
+			return errors.New("ttl must be positive")
+		}
+		s.ttl = ttl
+		return nil
+	}
+}
+
+// PostgresIdempotencyStoreWithClaimTimeout sets for how long a key is claimed by a delivery, defaults to 5 minutes. A
+// claim which is neither recorded nor released in time (e.g. after a crash) can be taken over by another delivery, so
+// the timeout should be longer than the handlers take. It does not apply within a transaction (see `WithTx`), where
+// the claim is held by the transaction.
+func PostgresIdempotencyStoreWithClaimTimeout(timeout time.Duration) postgresIdempotencyStoreOption {
+	return func(s *postgresIdempotencyStore) error {
+		if timeout <= 0 {
+			return errors.New("claim timeout must be positive")
+		}
+		s.claimTimeout = timeout
+		return nil
+	}
+}
+
+// PostgresIdempotencyStoreWithLogger sets the logger used by the store and its migrations, defaults to
+// `slog.Default()`.
+func PostgresIdempotencyStoreWithLogger(logger *slog.Logger) postgresIdempotencyStoreOption {
+	return func(s *postgresIdempotencyStore) error {
+		if logger == nil {
+			return errors.New("logger cannot be nil")
+		}
+		s.logger = logger
+		return nil
+	}
+}
+
+// NewPostgresIdempotencyStore returns a store which keeps the keys in the `idempotency_keys` table. The keys are read
+// and written within the transaction of the context, if there is one (see `WithTx`).
+func NewPostgresIdempotencyStore(db *sql.DB, options ...postgresIdempotencyStoreOption) (*postgresIdempotencyStore, error) {
+	store := &postgresIdempotencyStore{
+		db:             db,
+		logger:         slog.Default(),
+		schema:         "opinionatedevents",
+		skipMigrations: false,
+		claimTimeout:   5 * time.Minute,
+		removeInterval: 1 * time.Minute,
+	}
+	for _, apply := range options {
+		if err := apply(store); err != nil {
+			return nil, err
+		}
+	}
+	// make sure the migrations are run
+	if !store.skipMigrations {
+		if err := migrate(db, store.schema, store.logger); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// postgresQueryer is implemented by both `*sql.DB` and `*sql.Tx`
+type postgresQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (s *postgresIdempotencyStore) queryer(ctx context.Context) postgresQueryer {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return s.db
+}
+
+func (s *postgresIdempotencyStore) Claim(ctx context.Context, queue string, key string) (bool, error) {
+	// NOTE: within a transaction, a concurrent claim of the same key waits for the transaction to either commit (and the
+	// key is recorded) or roll back (and the key can be claimed)
+	claimQuery := withSchema(
+		`
+		INSERT INTO :SCHEMA.idempotency_keys AS k (queue, key, claimed_until)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (queue, key) DO UPDATE SET
+			recorded_at = now(),
+			claimed_until = excluded.claimed_until,
+			expires_at = NULL
+		WHERE
+			-- a claim which was neither recorded nor released in time, or a recorded key which has expired
+			(k.claimed_until IS NOT NULL AND k.claimed_until <= now()) OR
+			(k.claimed_until IS NULL AND k.expires_at <= now())
+		RETURNING true
+		`,
+		s.schema,
+	)
+	claimedQuery := withSchema(
+		`
+		SELECT claimed_until IS NOT NULL
+		FROM :SCHEMA.idempotency_keys
+		WHERE queue = $1 AND key = $2
+		`,
+		s.schema,
+	)
+	queryer := s.queryer(ctx)
+	claimedUntil := time.Now().Add(s.claimTimeout).UTC()
+	var claimed bool
+	err := queryer.QueryRowContext(ctx, claimQuery, queue, key, claimedUntil).Scan(&claimed)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	// the key is either recorded or claimed by another delivery
+	var claimedByOther bool
+	if err := queryer.QueryRowContext(ctx, claimedQuery, queue, key).Scan(&claimedByOther); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// the other claim was released in the meantime
+			return false, ErrIdempotencyKeyClaimed
+		}
+		return false, err
+	}
+	if claimedByOther {
+		return false, ErrIdempotencyKeyClaimed
+	}
+	return false, nil
+}
+
+func (s *postgresIdempotencyStore) Record(ctx context.Context, queue string, key string) error {
+	recordQuery := withSchema(
+		`
+		INSERT INTO :SCHEMA.idempotency_keys (queue, key, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (queue, key) DO UPDATE SET
+			recorded_at = now(),
+			claimed_until = NULL,
+			expires_at = excluded.expires_at
+		`,
+		s.schema,
+	)
+	var expiresAt *time.Time
+	if s.ttl > 0 {
+		t := time.Now().Add(s.ttl).UTC()
+		expiresAt = &t
+	}
+	if _, err := s.queryer(ctx).ExecContext(ctx, recordQuery, queue, key, expiresAt); err != nil {
+		return err
+	}
+	if s.ttl > 0 && s.shouldRemoveExpired() {
+		// NOTE: the expired keys are not seen anyway, so they can be removed on the next round if this fails
+		if err := s.removeExpired(ctx); err != nil {
+			s.logger.WarnContext(ctx, "failed to remove the expired idempotency keys", "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *postgresIdempotencyStore) Release(ctx context.Context, queue string, key string) error {
+	releaseQuery := withSchema(
+		`
+		DELETE FROM :SCHEMA.idempotency_keys
+		WHERE queue = $1 AND key = $2 AND claimed_until IS NOT NULL
+		`,
+		s.schema,
+	)
+	_, err := s.queryer(ctx).ExecContext(ctx, releaseQuery, queue, key)
+	return err
+}
+
+func (s *postgresIdempotencyStore) shouldRemoveExpired() bool {
+	s.removedAtMutex.Lock()
+	defer s.removedAtMutex.Unlock()
+	if time.Since(s.removedAt) < s.removeInterval {
+		return false
+	}
+	s.removedAt = time.Now()
+	return true
+}
+
+func (s *postgresIdempotencyStore) removeExpired(ctx context.Context) error {
+	removeExpiredQuery := withSchema(
+		`
+		DELETE FROM :SCHEMA.idempotency_keys
+		WHERE expires_at <= now()
+		`,
+		s.schema,
+	)
+	// NOTE: the keys are removed outside of the transaction of the handler, so that it is kept short
+	_, err := s.db.ExecContext(ctx, removeExpiredQuery)
+	return err
+}
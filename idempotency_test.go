@@ -0,0 +1,190 @@
+package opinionatedevents
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithIdempotency(t *testing.T) {
+	newTestHandler := func(store IdempotencyStore, options ...idempotencyOption) (OnMessageHandler, *int) {
+		calls := 0
+		handler := WithIdempotency(store, options...)(func(_ context.Context, delivery Delivery) error {
+			calls += 1
+			if delivery.GetAttempt() == 1 {
+				return errors.New("just a test")
+			}
+			return nil
+		})
+		return handler, &calls
+	}
+
+	t.Run("skips the duplicates of a handled message", func(t *testing.T) {
+		store, err := NewMemoryIdempotencyStore(0)
+		assert.NoError(t, err)
+		handler, calls := newTestHandler(store)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		// a failed attempt is not recorded
+		assert.Error(t, handler(context.Background(), &testDelivery{1, "default", msg}))
+		assert.NoError(t, handler(context.Background(), &testDelivery{2, "default", msg}))
+		assert.NoError(t, handler(context.Background(), &testDelivery{3, "default", msg}))
+		assert.Equal(t, 2, *calls)
+		// the same message on another queue is not a duplicate
+		assert.NoError(t, handler(context.Background(), &testDelivery{2, "other", msg}))
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("retries a duplicate which is delivered while the first one is being handled", func(t *testing.T) {
+		store, err := NewMemoryIdempotencyStore(0)
+		assert.NoError(t, err)
+		started, finish := make(chan struct{}), make(chan struct{})
+		var calls atomic.Int32
+		handler := WithIdempotency(store)(func(_ context.Context, _ Delivery) error {
+			calls.Add(1)
+			close(started)
+			<-finish
+			return nil
+		})
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		done := make(chan error)
+		go func() {
+			done <- handler(context.Background(), &testDelivery{1, "default", msg})
+		}()
+		<-started
+		err = handler(context.Background(), &testDelivery{1, "default", msg})
+		assert.ErrorIs(t, err, ErrIdempotencyKeyClaimed)
+		assert.False(t, IsFatal(err))
+		close(finish)
+		assert.NoError(t, <-done)
+		// the retried duplicate is skipped once the first one has succeeded
+		assert.NoError(t, handler(context.Background(), &testDelivery{2, "default", msg}))
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("releases the claim of a handler which timed out", func(t *testing.T) {
+		memory, err := NewMemoryIdempotencyStore(0)
+		assert.NoError(t, err)
+		store := &testContextIdempotencyStore{memory}
+		calls := 0
+		handler := WithTimeout(10 * time.Millisecond)(WithIdempotency(store)(func(ctx context.Context, _ Delivery) error {
+			calls += 1
+			if calls == 1 {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		}))
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, handler(context.Background(), &testDelivery{1, "default", msg}), context.DeadlineExceeded)
+		// the message is retried straight away and the handler runs again
+		assert.NoError(t, handler(context.Background(), &testDelivery{2, "default", msg}))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("uses a custom key", func(t *testing.T) {
+		store, err := NewMemoryIdempotencyStore(0)
+		assert.NoError(t, err)
+		handler, calls := newTestHandler(store, IdempotencyWithKey(func(delivery Delivery) string {
+			return delivery.GetMessage().GetHeader("request_id")
+		}))
+		for i := 0; i < 2; i += 1 {
+			msg, err := NewMessage("customers.created", nil, WithHeader("request_id", "1"))
+			assert.NoError(t, err)
+			assert.NoError(t, handler(context.Background(), &testDelivery{2, "default", msg}))
+		}
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("forgets the keys after the ttl", func(t *testing.T) {
+		store, err := NewMemoryIdempotencyStore(50 * time.Millisecond)
+		assert.NoError(t, err)
+		handler, calls := newTestHandler(store)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, handler(context.Background(), &testDelivery{2, "default", msg}))
+		assert.NoError(t, handler(context.Background(), &testDelivery{2, "default", msg}))
+		assert.Equal(t, 1, *calls)
+		time.Sleep(60 * time.Millisecond)
+		assert.NoError(t, handler(context.Background(), &testDelivery{2, "default", msg}))
+		assert.Equal(t, 2, *calls)
+	})
+}
+
+func TestPostgresIdempotencyStore(t *testing.T) {
+	db, schema := newTestPostgresDB(t)
+	store, err := NewPostgresIdempotencyStore(db,
+		PostgresIdempotencyStoreWithSchema(schema),
+		PostgresIdempotencyStoreWithTTL(time.Hour),
+	)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	// a key claimed within a rolled back transaction can be claimed again
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	claimed, err := store.Claim(WithTx(ctx, tx), "default", "1")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	assert.NoError(t, tx.Rollback())
+	// a claimed key cannot be claimed by another delivery until it is released
+	claimed, err = store.Claim(ctx, "default", "1")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	_, err = store.Claim(ctx, "default", "1")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyClaimed)
+	assert.NoError(t, store.Release(ctx, "default", "1"))
+	claimed, err = store.Claim(ctx, "default", "1")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	// a recorded key is skipped on the same queue only
+	assert.NoError(t, store.Record(ctx, "default", "1"))
+	claimed, err = store.Claim(ctx, "default", "1")
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+	claimed, err = store.Claim(ctx, "other", "1")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	// an expired key, and a claim which was never recorded nor released, can be claimed again
+	_, err = db.Exec(withSchema(`UPDATE :SCHEMA.idempotency_keys SET expires_at = now() WHERE queue = 'default'`, schema))
+	assert.NoError(t, err)
+	claimed, err = store.Claim(ctx, "default", "1")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	_, err = db.Exec(withSchema(`UPDATE :SCHEMA.idempotency_keys SET claimed_until = now()`, schema))
+	assert.NoError(t, err)
+	claimed, err = store.Claim(ctx, "default", "1")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+}
+
+// testContextIdempotencyStore fails like the database stores do when the context is done
+type testContextIdempotencyStore struct {
+	*memoryIdempotencyStore
+}
+
+func (s *testContextIdempotencyStore) Claim(ctx context.Context, queue string, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return s.memoryIdempotencyStore.Claim(ctx, queue, key)
+}
+
+func (s *testContextIdempotencyStore) Record(ctx context.Context, queue string, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.memoryIdempotencyStore.Record(ctx, queue, key)
+}
+
+func (s *testContextIdempotencyStore) Release(ctx context.Context, queue string, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.memoryIdempotencyStore.Release(ctx, queue, key)
+}
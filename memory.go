@@ -0,0 +1,189 @@
+package opinionatedevents
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+type memoryEvent struct {
+	id               int64
+	uuid             string
+	publishedAt      time.Time
+	topic            string
+	queue            string
+	name             string
+	orderingKey      string
+	priority         int
+	status           string
+	deliverAt        time.Time
+	expiresAt        time.Time
+	deliveryAttempts int
+	payload          []byte
+	claimed          bool
+}
+
+// memory bus is the shared, in-process storage used by the memory destination and source
+type memoryBus struct {
+	mutex       sync.Mutex
+	nextID      int64
+	routing     map[string][]string
+	events      []*memoryEvent
+	subscribers []chan struct{}
+}
+
+func NewMemoryBus() *memoryBus {
+	return &memoryBus{
+		nextID:      1,
+		routing:     map[string][]string{},
+		events:      []*memoryEvent{},
+		subscribers: []chan struct{}{},
+	}
+}
+
+func (b *memoryBus) declare(topic string, queue string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if slices.Contains(b.routing[topic], queue) {
+		return
+	}
+	b.routing[topic] = append(b.routing[topic], queue)
+}
+
+func (b *memoryBus) queues(topic string) []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]string{}, b.routing[topic]...)
+}
+
+func (b *memoryBus) subscribe(c chan struct{}) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscribers = append(b.subscribers, c)
+}
+
+func (b *memoryBus) notify() {
+	b.mutex.Lock()
+	subscribers := append([]chan struct{}{}, b.subscribers...)
+	b.mutex.Unlock()
+	for _, c := range subscribers {
+		// the subscribers are expected to use a buffered channel, a pending notification is enough
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *memoryBus) insert(events ...*memoryEvent) {
+	b.mutex.Lock()
+	for _, event := range events {
+		// mimic the `ON CONFLICT (queue, uuid) DO NOTHING` behaviour of postgres
+		exists := false
+		for _, existing := range b.events {
+			if existing.queue == event.queue && existing.uuid == event.uuid {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+		event.id = b.nextID
+		b.nextID += 1
+		b.events = append(b.events, event)
+	}
+	b.mutex.Unlock()
+	b.notify()
+}
+
+// claim finds the pending event which is due and has a handler, in the same order as the postgres source (see
+// `claimAt`), and marks it as claimed
+func (b *memoryBus) claim(messagesWithHandlers map[string][]string, now time.Time) *memoryEvent {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var next *memoryEvent
+	for _, event := range b.events {
+		if event.status != "pending" || event.claimed || event.deliverAt.After(now) {
+			continue
+		}
+		if !slices.Contains(messagesWithHandlers[event.queue], event.name) {
+			continue
+		}
+		if !event.expiresAt.IsZero() && !event.expiresAt.After(now) {
+			// the expired events are marked as such instead of being delivered
+			event.status = "expired"
+			continue
+		}
+		if b.isBlocked(event, messagesWithHandlers) {
+			continue
+		}
+		if next == nil || event.claimAt().Before(next.claimAt()) {
+			next = event
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	next.claimed = true
+	next.deliveryAttempts += 1
+	return next
+}
+
+// claimAt moves the time the event is due a minute earlier for every level of priority, so that the higher priorities
+// are served first while an event which has waited for long enough overtakes them
+func (e *memoryEvent) claimAt() time.Time {
+	return e.deliverAt.Add(-time.Duration(e.priority) * time.Minute)
+}
+
+// isBlocked checks if an earlier event with the same ordering key is still pending on the queue, the events without a
+// handler never block as they would stay pending forever, the mutex must be held
+func (b *memoryBus) isBlocked(event *memoryEvent, messagesWithHandlers map[string][]string) bool {
+	if event.orderingKey == "" {
+		return false
+	}
+	for _, other := range b.events {
+		if other.id >= event.id {
+			// the events are kept in the order they were inserted
+			break
+		}
+		if other.status != "pending" || other.queue != event.queue || other.orderingKey != event.orderingKey {
+			continue
+		}
+		if slices.Contains(messagesWithHandlers[other.queue], other.name) {
+			return true
+		}
+	}
+	return false
+}
+
+// release records the outcome of a claimed event and makes it available again if still pending
+func (b *memoryBus) release(event *memoryEvent, status string, deliverAt time.Time) {
+	b.mutex.Lock()
+	event.claimed = false
+	event.status = status
+	event.deliverAt = deliverAt
+	b.mutex.Unlock()
+	b.notify()
+}
+
+// nextDeliverAt returns the earliest delivery time of the pending events which are not yet due by the given time
+func (b *memoryBus) nextDeliverAt(messagesWithHandlers map[string][]string, now time.Time) (time.Time, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var next time.Time
+	found := false
+	for _, event := range b.events {
+		if event.status != "pending" || event.claimed || !event.deliverAt.After(now) {
+			continue
+		}
+		if !slices.Contains(messagesWithHandlers[event.queue], event.name) || b.isBlocked(event, messagesWithHandlers) {
+			continue
+		}
+		if !found || event.deliverAt.Before(next) {
+			next = event.deliverAt
+			found = true
+		}
+	}
+	return next, found
+}
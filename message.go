@@ -2,6 +2,7 @@ package opinionatedevents
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -12,24 +13,46 @@ import (
 	"github.com/google/uuid"
 )
 
+type encodedEncryption struct {
+	KeyID   string `json:"key_id" validate:"required"`
+	DataKey []byte `json:"data_key" validate:"required"`
+}
+
 type encodedMeta struct {
-	UUID        string    `json:"uuid" validate:"required"`
-	PublishedAt time.Time `json:"published_at" validate:"required"`
-	DeliverAt   time.Time `json:"deliver_at" validate:"required"`
+	UUID        string             `json:"uuid" validate:"required"`
+	PublishedAt time.Time          `json:"published_at" validate:"required"`
+	DeliverAt   time.Time          `json:"deliver_at" validate:"required"`
+	ExpiresAt   *time.Time         `json:"expires_at,omitempty"`
+	Trace       map[string]string  `json:"trace,omitempty"`
+	Version     int                `json:"version,omitempty"`
+	Encryption  *encodedEncryption `json:"encryption,omitempty"`
+	OrderingKey string             `json:"ordering_key,omitempty"`
+	Priority    int                `json:"priority,omitempty"`
 }
 
 type encodedMessage struct {
-	Name    string      `json:"name" validate:"required"`
-	Meta    encodedMeta `json:"meta" validate:"required"`
-	Payload []byte      `json:"payload"`
+	Name        string            `json:"name" validate:"required"`
+	Meta        encodedMeta       `json:"meta" validate:"required"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Payload     []byte            `json:"payload"`
 }
 
 type Message struct {
+	codec       Codec
+	contentType string
+	encryption  *messageEncryption
 	uuid        string
 	name        string
+	orderingKey string
+	priority    int
 	publishedAt time.Time
 	deliverAt   time.Time
+	expiresAt   time.Time
+	headers     map[string]string
 	payload     []byte
+	trace       map[string]string
+	version     int
 }
 
 func (msg *Message) GetUUID() string {
@@ -52,8 +75,70 @@ func (msg *Message) GetDeliverAt() time.Time {
 	return msg.deliverAt
 }
 
+// GetExpiresAt returns the time after which the message is no longer handled, or a zero time if it never expires.
+func (msg *Message) GetExpiresAt() time.Time {
+	return msg.expiresAt
+}
+
+// isExpired checks if the message has an expiry time which has passed by the given time
+func (msg *Message) isExpired(now time.Time) bool {
+	return !msg.expiresAt.IsZero() && !msg.expiresAt.After(now)
+}
+
+// GetVersion returns the version of the payload, the messages published before versions were tracked are version 1.
+func (msg *Message) GetVersion() int {
+	if msg.version <= 0 {
+		return 1
+	}
+	return msg.version
+}
+
+// GetOrderingKey returns the ordering key of the message, or an empty string if the message does not have one.
+func (msg *Message) GetOrderingKey() string {
+	return msg.orderingKey
+}
+
+// GetPriority returns the priority of the message, the default priority is 0.
+func (msg *Message) GetPriority() int {
+	return msg.priority
+}
+
+// GetHeader returns the value of the header, or an empty string if the message does not have it.
+func (msg *Message) GetHeader(key string) string {
+	return msg.headers[key]
+}
+
+// GetHeaders returns a copy of every header of the message.
+func (msg *Message) GetHeaders() map[string]string {
+	headers := make(map[string]string, len(msg.headers))
+	for key, value := range msg.headers {
+		headers[key] = value
+	}
+	return headers
+}
+
+// GetContentType returns the content type of the payload, the messages published before content types were tracked
+// are always JSON.
+func (msg *Message) GetContentType() string {
+	if msg.contentType == "" {
+		return JSONCodec.ContentType()
+	}
+	return msg.contentType
+}
+
+// GetPayload decodes the payload with the codec registered for the content type of the message.
 func (msg *Message) GetPayload(payload any) error {
-	return json.Unmarshal(msg.payload, payload)
+	if msg.encryption != nil {
+		return errors.New("payload is encrypted, the receiver must be configured with the key provider")
+	}
+	codec := msg.codec
+	if codec == nil {
+		var err error
+		if codec, err = getCodec(msg.GetContentType()); err != nil {
+			return err
+		}
+	}
+	return codec.Unmarshal(msg.payload, payload)
 }
 
 var (
@@ -83,8 +168,21 @@ func (msg *Message) MarshalJSON() ([]byte, error) {
 			UUID:        msg.uuid,
 			PublishedAt: msg.publishedAt.UTC(),
 			DeliverAt:   msg.deliverAt.UTC(),
+			Trace:       msg.trace,
+			Version:     msg.version,
+			OrderingKey: msg.orderingKey,
+			Priority:    msg.priority,
 		},
-		Payload: msg.payload,
+		Headers:     msg.headers,
+		ContentType: msg.contentType,
+		Payload:     msg.payload,
+	}
+	if !msg.expiresAt.IsZero() {
+		expiresAt := msg.expiresAt.UTC()
+		s.Meta.ExpiresAt = &expiresAt
+	}
+	if msg.encryption != nil {
+		s.Meta.Encryption = &encodedEncryption{KeyID: msg.encryption.keyID, DataKey: msg.encryption.dataKey}
 	}
 	if err := getValidator().Struct(&s); err != nil {
 		return nil, err
@@ -107,7 +205,19 @@ func (msg *Message) UnmarshalJSON(data []byte) error {
 	msg.name = s.Name
 	msg.publishedAt = s.Meta.PublishedAt
 	msg.deliverAt = s.Meta.DeliverAt
+	msg.headers = s.Headers
+	msg.contentType = s.ContentType
 	msg.payload = s.Payload
+	msg.trace = s.Meta.Trace
+	msg.version = s.Meta.Version
+	msg.orderingKey = s.Meta.OrderingKey
+	msg.priority = s.Meta.Priority
+	if s.Meta.ExpiresAt != nil {
+		msg.expiresAt = *s.Meta.ExpiresAt
+	}
+	if s.Meta.Encryption != nil {
+		msg.encryption = &messageEncryption{keyID: s.Meta.Encryption.KeyID, dataKey: s.Meta.Encryption.DataKey}
+	}
 	return nil
 }
 
@@ -119,6 +229,70 @@ func WithDeliverAt(when time.Time) MessageOption {
 	}
 }
 
+// WithExpiresAt sets the time after which the message is worthless, e.g. a "user is typing" notification. The expired
+// messages are skipped by the sources (and marked as `expired` in Postgres) instead of being delivered.
+func WithExpiresAt(when time.Time) MessageOption {
+	return func(msg *Message) {
+		msg.expiresAt = when
+	}
+}
+
+// WithTTL sets the message to expire after the given duration from the time it is published, see `WithExpiresAt`.
+func WithTTL(ttl time.Duration) MessageOption {
+	return func(msg *Message) {
+		msg.expiresAt = msg.publishedAt.Add(ttl)
+	}
+}
+
+// WithVersion sets the version of the payload, starting from 1 which is also the default. The older versions can be
+// upcasted to the version expected by a handler with an `UpcasterRegistry`.
+func WithVersion(version int) MessageOption {
+	return func(msg *Message) {
+		msg.version = version
+	}
+}
+
+// WithOrderingKey sets the ordering key of the message, e.g. the id of a customer. The messages with the same ordering
+// key are handled one at a time in the order they were published, per queue. A message which is being retried blocks
+// the messages after it until it is processed or dropped.
+func WithOrderingKey(key string) MessageOption {
+	return func(msg *Message) {
+		msg.orderingKey = key
+	}
+}
+
+// WithPriority sets the priority of the message, defaults to 0. The messages with a higher priority are handled before
+// the ones with a lower priority on the same queue, but every level of priority is worth only a minute of waiting so
+// that the lower priorities are not starved.
+func WithPriority(priority int) MessageOption {
+	return func(msg *Message) {
+		msg.priority = priority
+	}
+}
+
+// WithCodec sets the codec used for encoding the payload, defaults to `JSONCodec`. The codec must be registered with
+// `RegisterCodec` on the receiving side, unless it is one of the built-in codecs.
+func WithCodec(codec Codec) MessageOption {
+	return func(msg *Message) {
+		msg.codec = codec
+	}
+}
+
+// WithHeader sets a header on the message, e.g. a tenant id or the name of the publishing service.
+func WithHeader(key string, value string) MessageOption {
+	return func(msg *Message) {
+		if msg.headers == nil {
+			msg.headers = map[string]string{}
+		}
+		msg.headers[key] = value
+	}
+}
+
+// messageLogAttrs returns the structured logging fields which identify the message
+func messageLogAttrs(msg *Message) []any {
+	return []any{"name", msg.GetName(), "uuid", msg.GetUUID()}
+}
+
 func NewMessage(name string, payload any, options ...MessageOption) (*Message, error) {
 	pattern := "^[a-zA-Z0-9_\\-]+\\.[a-zA-Z0-9_\\-]+$"
 	if matched, _ := regexp.MatchString(pattern, name); !matched {
@@ -126,20 +300,26 @@ func NewMessage(name string, payload any, options ...MessageOption) (*Message, e
 	}
 	now := time.Now()
 	msg := &Message{
+		codec:       JSONCodec,
 		uuid:        uuid.NewString(),
 		name:        name,
 		publishedAt: now,
 		deliverAt:   now,
 	}
+	// the options are applied first, as they may change how the payload is encoded
+	for _, option := range options {
+		option(msg)
+	}
+	if msg.codec == nil {
+		return nil, errors.New("codec cannot be nil")
+	}
+	msg.contentType = msg.codec.ContentType()
 	if payload != nil {
-		data, err := json.Marshal(payload)
+		data, err := msg.codec.Marshal(payload)
 		if err != nil {
 			return nil, err
 		}
 		msg.payload = data
 	}
-	for _, option := range options {
-		option(msg)
-	}
 	return msg, nil
 }
@@ -46,6 +46,74 @@ func TestMessageSerialization(t *testing.T) {
 		assert.Equal(t, unserialized.publishedAt.Unix(), unserialized.deliverAt.Unix())
 	})
 
+	t.Run("round-trips the headers", func(t *testing.T) {
+		message, err := NewMessage("test.test", nil,
+			WithHeader("tenant", "acme"),
+			WithHeader("service", "billing"),
+		)
+		assert.NoError(t, err)
+		serialized, err := json.Marshal(message)
+		assert.NoError(t, err)
+		assert.Contains(t, string(serialized), `"headers":{"service":"billing","tenant":"acme"}`)
+		unserialized := &Message{}
+		assert.NoError(t, json.Unmarshal(serialized, unserialized))
+		assert.Equal(t, "acme", unserialized.GetHeader("tenant"))
+		assert.Equal(t, map[string]string{"tenant": "acme", "service": "billing"}, unserialized.GetHeaders())
+		assert.Equal(t, "", unserialized.GetHeader("unknown"))
+	})
+
+	t.Run("round-trips the ordering key", func(t *testing.T) {
+		message, err := NewMessage("test.test", nil, WithOrderingKey("customer-42"))
+		assert.NoError(t, err)
+		serialized, err := json.Marshal(message)
+		assert.NoError(t, err)
+		assert.Contains(t, string(serialized), `"ordering_key":"customer-42"`)
+		unserialized := &Message{}
+		assert.NoError(t, json.Unmarshal(serialized, unserialized))
+		assert.Equal(t, "customer-42", unserialized.GetOrderingKey())
+	})
+
+	t.Run("round-trips the priority", func(t *testing.T) {
+		message, err := NewMessage("test.test", nil, WithPriority(10))
+		assert.NoError(t, err)
+		serialized, err := json.Marshal(message)
+		assert.NoError(t, err)
+		unserialized := &Message{}
+		assert.NoError(t, json.Unmarshal(serialized, unserialized))
+		assert.Equal(t, 10, unserialized.GetPriority())
+	})
+
+	t.Run("round-trips the expiry time", func(t *testing.T) {
+		message, err := NewMessage("test.test", nil, WithTTL(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, message.GetPublishedAt().Add(time.Minute), message.GetExpiresAt())
+		serialized, err := json.Marshal(message)
+		assert.NoError(t, err)
+		assert.Contains(t, string(serialized), `"expires_at":`)
+		unserialized := &Message{}
+		assert.NoError(t, json.Unmarshal(serialized, unserialized))
+		assert.Equal(t, message.GetExpiresAt().Unix(), unserialized.GetExpiresAt().Unix())
+		// the messages without an expiry time never expire
+		message, err = NewMessage("test.test", nil)
+		assert.NoError(t, err)
+		serialized, err = json.Marshal(message)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(serialized), `"expires_at":`)
+		assert.False(t, message.isExpired(time.Now().Add(24*time.Hour)))
+	})
+
+	t.Run("unmarshals correctly when no headers present", func(t *testing.T) {
+		serialized := `{"name":"test","meta":{"uuid":"12345","published_at":"2021-10-10T12:32:00Z"},"payload":""}`
+		unserialized := &Message{}
+		assert.NoError(t, json.Unmarshal([]byte(serialized), unserialized))
+		assert.Equal(t, "", unserialized.GetHeader("tenant"))
+		assert.Empty(t, unserialized.GetHeaders())
+		// the message without headers should be encoded without them as well
+		reserialized, err := json.Marshal(unserialized)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(reserialized), "headers")
+	})
+
 	t.Run("does not accept invalid JSON", func(t *testing.T) {
 		messages := []struct {
 			value string
@@ -0,0 +1,65 @@
+package opinionatedevents
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Labels are the dimensions of a single metric series, e.g. `{"queue": "default"}`.
+type Labels map[string]string
+
+// Metrics receives the measurements of the library. It can be implemented to forward the measurements to any metrics
+// system, or `NewPrometheusMetrics` can be used to expose them in the Prometheus text format.
+type Metrics interface {
+	// AddCounter increments the counter by the given (non-negative) value.
+	AddCounter(name string, labels Labels, value float64)
+	// ObserveHistogram records a single observation, e.g. a duration in seconds.
+	ObserveHistogram(name string, labels Labels, value float64)
+	// SetGauge sets the gauge to the given value.
+	SetGauge(name string, labels Labels, value float64)
+}
+
+// the metrics reported by the library
+const (
+	MetricPublishedMessages     string = "opinionatedevents_published_messages_total"
+	MetricPublishErrors         string = "opinionatedevents_publish_errors_total"
+	MetricPublishRetries        string = "opinionatedevents_publish_retries_total"
+	MetricPublishFailures       string = "opinionatedevents_publish_failures_total"
+	MetricPublishDuration       string = "opinionatedevents_publish_duration_seconds"
+	MetricDeliveries            string = "opinionatedevents_deliveries_total"
+	MetricHandlerDuration       string = "opinionatedevents_handler_duration_seconds"
+	MetricQueueDepth            string = "opinionatedevents_queue_depth"
+	MetricQueueOldestPendingAge string = "opinionatedevents_queue_oldest_pending_age_seconds"
+)
+
+var metricDescriptions = map[string]string{
+	MetricPublishedMessages:     "Number of messages delivered to a destination.",
+	MetricPublishErrors:         "Number of failed attempts to deliver a batch of messages to a destination.",
+	MetricPublishRetries:        "Number of times a batch of messages was retried by the async bridge.",
+	MetricPublishFailures:       "Number of messages which could not be delivered to a destination.",
+	MetricPublishDuration:       "Duration of delivering a batch of messages to a destination.",
+	MetricDeliveries:            "Number of messages delivered to handlers, by outcome.",
+	MetricHandlerDuration:       "Duration of handling a message.",
+	MetricQueueDepth:            "Number of pending messages in a queue.",
+	MetricQueueOldestPendingAge: "Age of the oldest message in a queue which is due but not yet processed.",
+}
+
+type noopMetrics struct{}
+
+func (m *noopMetrics) AddCounter(_ string, _ Labels, _ float64)       {}
+func (m *noopMetrics) ObserveHistogram(_ string, _ Labels, _ float64) {}
+func (m *noopMetrics) SetGauge(_ string, _ Labels, _ float64)         {}
+
+// destinationName returns a short name for the destination to be used as a label, e.g. "postgres" for
+// `*postgresDestination`
+func destinationName(destination Destination) string {
+	t := reflect.TypeOf(destination)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	name := strings.TrimSuffix(t.Name(), "Destination")
+	if name == "" {
+		return t.Name()
+	}
+	return strings.ToLower(name)
+}
@@ -0,0 +1,215 @@
+package opinionatedevents
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type prometheusMetricType string
+
+const (
+	prometheusCounter   prometheusMetricType = "counter"
+	prometheusGauge     prometheusMetricType = "gauge"
+	prometheusHistogram prometheusMetricType = "histogram"
+)
+
+type prometheusSeries struct {
+	labels Labels
+	value  float64
+	// histograms only
+	buckets []uint64
+	count   uint64
+}
+
+type prometheusMetric struct {
+	kind   prometheusMetricType
+	series map[string]*prometheusSeries
+}
+
+// PrometheusMetrics keeps the measurements in memory and serves them in the Prometheus text format.
+type PrometheusMetrics struct {
+	buckets []float64
+	metrics map[string]*prometheusMetric
+	mutex   sync.Mutex
+}
+
+type prometheusMetricsOption func(m *PrometheusMetrics) error
+
+// PrometheusMetricsWithBuckets sets the upper bounds of the histogram buckets, defaults to the Prometheus defaults
+// (from 5ms to 10s).
+func PrometheusMetricsWithBuckets(buckets ...float64) prometheusMetricsOption {
+	return func(m *PrometheusMetrics) error {
+		if len(buckets) == 0 {
+			return errors.New("at least one bucket is required")
+		}
+		if !slices.IsSorted(buckets) {
+			return errors.New("buckets must be in increasing order")
+		}
+		m.buckets = buckets
+		return nil
+	}
+}
+
+func NewPrometheusMetrics(options ...prometheusMetricsOption) (*PrometheusMetrics, error) {
+	metrics := &PrometheusMetrics{
+		buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		metrics: map[string]*prometheusMetric{},
+	}
+	for _, apply := range options {
+		if err := apply(metrics); err != nil {
+			return nil, err
+		}
+	}
+	return metrics, nil
+}
+
+func (m *PrometheusMetrics) AddCounter(name string, labels Labels, value float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if series := m.getSeries(name, prometheusCounter, labels); series != nil {
+		series.value += value
+	}
+}
+
+func (m *PrometheusMetrics) ObserveHistogram(name string, labels Labels, value float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	series := m.getSeries(name, prometheusHistogram, labels)
+	if series == nil {
+		return
+	}
+	if series.buckets == nil {
+		series.buckets = make([]uint64, len(m.buckets))
+	}
+	for i, upperBound := range m.buckets {
+		if value <= upperBound {
+			series.buckets[i] += 1
+		}
+	}
+	series.value += value
+	series.count += 1
+}
+
+func (m *PrometheusMetrics) SetGauge(name string, labels Labels, value float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if series := m.getSeries(name, prometheusGauge, labels); series != nil {
+		series.value = value
+	}
+}
+
+// getSeries returns the series of the metric with the labels, or nil if the metric already exists with another type
+func (m *PrometheusMetrics) getSeries(name string, kind prometheusMetricType, labels Labels) *prometheusSeries {
+	metric, ok := m.metrics[name]
+	if !ok {
+		metric = &prometheusMetric{kind: kind, series: map[string]*prometheusSeries{}}
+		m.metrics[name] = metric
+	}
+	if metric.kind != kind {
+		return nil
+	}
+	key := formatPrometheusLabels(labels)
+	series, ok := metric.series[key]
+	if !ok {
+		copied := make(Labels, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		series = &prometheusSeries{labels: copied}
+		metric.series[key] = series
+	}
+	return series
+}
+
+// WriteTo writes every metric in the Prometheus text format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var b strings.Builder
+	names := make([]string, 0, len(m.metrics))
+	for name := range m.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		metric := m.metrics[name]
+		if description, ok := metricDescriptions[name]; ok {
+			fmt.Fprintf(&b, "# HELP %s %s\n", name, description)
+		}
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, metric.kind)
+		keys := make([]string, 0, len(metric.series))
+		for key := range metric.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			series := metric.series[key]
+			if metric.kind != prometheusHistogram {
+				fmt.Fprintf(&b, "%s%s %s\n", name, key, formatPrometheusValue(series.value))
+				continue
+			}
+			for i, upperBound := range m.buckets {
+				labels := withPrometheusLabel(series.labels, "le", formatPrometheusValue(upperBound))
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, formatPrometheusLabels(labels), series.buckets[i])
+			}
+			labels := withPrometheusLabel(series.labels, "le", "+Inf")
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, formatPrometheusLabels(labels), series.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, key, formatPrometheusValue(series.value))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, key, series.count)
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP exposes the metrics to be scraped by Prometheus, e.g. at `/metrics`.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w) //nolint the error is not relevant
+}
+
+func withPrometheusLabel(labels Labels, key string, value string) Labels {
+	result := make(Labels, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+func formatPrometheusLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, key, replacer.Replace(labels[key]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatPrometheusValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,91 @@
+package opinionatedevents
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	t.Run("writes the metrics in the text format", func(t *testing.T) {
+		metrics, err := NewPrometheusMetrics(PrometheusMetricsWithBuckets(0.1, 1))
+		assert.NoError(t, err)
+		metrics.AddCounter(MetricDeliveries, Labels{"queue": "default", "outcome": "processed"}, 1)
+		metrics.AddCounter(MetricDeliveries, Labels{"queue": "default", "outcome": "processed"}, 2)
+		metrics.SetGauge("custom_gauge", Labels{"name": "with \"quotes\""}, 5)
+		metrics.SetGauge("custom_gauge", Labels{"name": "with \"quotes\""}, 3)
+		metrics.ObserveHistogram(MetricHandlerDuration, nil, 0.05)
+		metrics.ObserveHistogram(MetricHandlerDuration, nil, 0.5)
+		metrics.ObserveHistogram(MetricHandlerDuration, nil, 5)
+		resp := httptest.NewRecorder()
+		metrics.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, strings.Join([]string{
+			`# TYPE custom_gauge gauge`,
+			`custom_gauge{name="with \"quotes\""} 3`,
+			`# HELP opinionatedevents_deliveries_total Number of messages delivered to handlers, by outcome.`,
+			`# TYPE opinionatedevents_deliveries_total counter`,
+			`opinionatedevents_deliveries_total{outcome="processed",queue="default"} 3`,
+			`# HELP opinionatedevents_handler_duration_seconds Duration of handling a message.`,
+			`# TYPE opinionatedevents_handler_duration_seconds histogram`,
+			`opinionatedevents_handler_duration_seconds_bucket{le="0.1"} 1`,
+			`opinionatedevents_handler_duration_seconds_bucket{le="1"} 2`,
+			`opinionatedevents_handler_duration_seconds_bucket{le="+Inf"} 3`,
+			`opinionatedevents_handler_duration_seconds_sum 5.55`,
+			`opinionatedevents_handler_duration_seconds_count 3`,
+			``,
+		}, "\n"), resp.Body.String())
+	})
+
+	t.Run("ignores measurements with a conflicting type", func(t *testing.T) {
+		metrics, err := NewPrometheusMetrics()
+		assert.NoError(t, err)
+		metrics.AddCounter("conflicting", nil, 1)
+		metrics.SetGauge("conflicting", nil, 5)
+		var b strings.Builder
+		_, err = metrics.WriteTo(&b)
+		assert.NoError(t, err)
+		assert.Equal(t, "# TYPE conflicting counter\nconflicting 1\n", b.String())
+	})
+
+	t.Run("records the published messages and the deliveries", func(t *testing.T) {
+		metrics, err := NewPrometheusMetrics()
+		assert.NoError(t, err)
+		bus := NewMemoryBus()
+		failing := newTestDestination()
+		failing.pushHandler(func(_ context.Context, _ []*Message) error { return errors.New("just a test") })
+		publisher, err := NewPublisher(
+			PublisherWithSyncBridge(NewMemoryDestination(bus), failing),
+			PublisherWithMetrics(metrics),
+		)
+		assert.NoError(t, err)
+		receiver, err := NewReceiver(ReceiverWithMetrics(metrics))
+		assert.NoError(t, err)
+		assert.NoError(t, receiver.On("default", "customers.created", func(_ context.Context, _ Delivery) error {
+			return Fatal(errors.New("just a test"))
+		}))
+		assert.NoError(t, receiver.Start(context.Background()))
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.Error(t, publisher.PublishOne(context.Background(), msg))
+		assert.Error(t, receiver.Deliver(context.Background(), &testDelivery{1, "default", msg}))
+		var b strings.Builder
+		_, err = metrics.WriteTo(&b)
+		assert.NoError(t, err)
+		assert.Contains(t, b.String(), `opinionatedevents_published_messages_total{destination="memory"} 1`)
+		assert.Contains(t, b.String(), `opinionatedevents_publish_errors_total{destination="test"} 1`)
+		assert.Contains(t, b.String(), `opinionatedevents_publish_failures_total{destination="test"} 1`)
+		assert.Contains(t, b.String(), `opinionatedevents_publish_duration_seconds_count{destination="memory"} 1`)
+		assert.Contains(t, b.String(),
+			`opinionatedevents_deliveries_total{name="customers.created",outcome="dropped",queue="default"} 1`,
+		)
+		assert.Contains(t, b.String(),
+			`opinionatedevents_handler_duration_seconds_count{name="customers.created",queue="default"} 1`,
+		)
+	})
+}
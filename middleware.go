@@ -2,9 +2,14 @@ package opinionatedevents
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 )
 
+// ErrTimeout is returned (wrapped) when a handler does not finish before its deadline.
+var ErrTimeout = errors.New("handler timed out")
+
 type OnMessageMiddleware func(next OnMessageHandler) OnMessageHandler
 
 func WithBackoff(backoff Backoff) OnMessageMiddleware {
@@ -38,3 +43,25 @@ func WithLimit(limit int) OnMessageMiddleware {
 		}
 	}
 }
+
+// WithTimeout cancels the context of the handler after the given duration. A handler which returns an error after
+// timing out is retried later on, even if it returned a fatal error. The handler must respect its context, it is not
+// interrupted otherwise. Place it inside `WithLimit` and `WithBackoff` so that they apply to the timeouts as well.
+func WithTimeout(timeout time.Duration) OnMessageMiddleware {
+	return func(next OnMessageHandler) OnMessageHandler {
+		return func(ctx context.Context, delivery Delivery) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := next(ctx, delivery)
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				// the handler most likely failed because of the timeout, so it should not be dropped
+				var fatalErr *fatalError
+				if errors.As(err, &fatalErr) {
+					err = fatalErr.err
+				}
+				return fmt.Errorf("%w after %s: %w", ErrTimeout, timeout, err)
+			}
+			return err
+		}
+	}
+}
@@ -83,3 +83,51 @@ func TestLimitAndBackoffMiddlewares(t *testing.T) {
 	assert.NotNil(t, r3)
 	assert.True(t, IsFatal(r3))
 }
+
+func TestTimeoutMiddleware(t *testing.T) {
+	queue := "test"
+	msg, err := NewMessage("test.test", &testMessagePayload{"test"})
+	assert.NoError(t, err)
+	t.Run("cancels the context after the timeout", func(t *testing.T) {
+		handler := WithTimeout(10 * time.Millisecond)(
+			func(ctx context.Context, delivery Delivery) error {
+				<-ctx.Done()
+				return Fatal(ctx.Err())
+			},
+		)
+		r := handler(context.Background(), &testDelivery{1, queue, msg})
+		assert.ErrorIs(t, r, ErrTimeout)
+		assert.ErrorIs(t, r, context.DeadlineExceeded)
+		assert.False(t, IsFatal(r))
+	})
+	t.Run("does not touch the result if the handler finishes in time", func(t *testing.T) {
+		handler := WithTimeout(time.Second)(
+			func(ctx context.Context, delivery Delivery) error {
+				return Fatal(errors.New("just a test"))
+			},
+		)
+		r := handler(context.Background(), &testDelivery{1, queue, msg})
+		assert.NotErrorIs(t, r, ErrTimeout)
+		assert.True(t, IsFatal(r))
+	})
+	t.Run("is retried with a backoff and dropped after the limit", func(t *testing.T) {
+		handler := WithLimit(2)(
+			WithBackoff(ConstantBackoff(10 * time.Second))(
+				WithTimeout(10 * time.Millisecond)(
+					func(ctx context.Context, delivery Delivery) error {
+						<-ctx.Done()
+						return ctx.Err()
+					},
+				),
+			),
+		)
+		r1 := handler(context.Background(), &testDelivery{1, queue, msg})
+		assert.False(t, IsFatal(r1))
+		var r1r *retryError
+		assert.True(t, errors.As(r1, &r1r))
+		assert.LessOrEqual(t, math.Abs(float64(time.Until(r1r.retryAt).Milliseconds()-10000)), 10.0)
+		r2 := handler(context.Background(), &testDelivery{2, queue, msg})
+		assert.ErrorIs(t, r2, ErrTimeout)
+		assert.True(t, IsFatal(r2))
+	})
+}
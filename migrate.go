@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"embed"
 	"fmt"
+	"log/slog"
 	"strconv"
 
 	"github.com/lib/pq"
@@ -85,7 +86,7 @@ func installSchema(db *sql.DB, schema string) error {
 	return err
 }
 
-func migrate(db *sql.DB, schema string) error {
+func migrate(db *sql.DB, schema string, logger *slog.Logger) error {
 	latestMigration, err := getLatestMigration(db, schema)
 	if err != nil {
 		if pqerr, ok := err.(*pq.Error); ok {
@@ -107,7 +108,7 @@ func migrate(db *sql.DB, schema string) error {
 		if idx <= latestMigration {
 			return nil
 		}
-		fmt.Printf("running migration %s...\n", name)
+		logger.Info("running a migration", "schema", schema, "migration", name)
 		if err := up(db, schema, idx, string(content)); err != nil {
 			return err
 		}
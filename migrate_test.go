@@ -3,6 +3,7 @@ package opinionatedevents
 import (
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"math/rand"
 	"testing"
 
@@ -17,6 +18,6 @@ func TestMigrate(t *testing.T) {
 	schema := fmt.Sprintf("opinionatedevents_%d", r.Int())
 	db, err := sql.Open("postgres", connectionString)
 	assert.NoError(t, err)
-	err = migrate(db, schema)
+	err = migrate(db, schema, slog.Default())
 	assert.NoError(t, err)
 }
@@ -0,0 +1,4 @@
+-- a message is claimed by a worker by leasing it until `locked_until`, after which it can be claimed again
+alter table :SCHEMA.events
+  add column locked_until timestamptz,
+  add column locked_by text;
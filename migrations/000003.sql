@@ -0,0 +1,10 @@
+-- the reason a message was dropped, removed when the message is requeued
+create table :SCHEMA.dead_letters (
+  event_id bigint primary key references :SCHEMA.events (id) on delete cascade,
+  dropped_at timestamptz not null default now(),
+  error text not null
+);
+
+-- an index for listing the dropped messages by the time they were dropped
+create index dead_letters_dropped_at_idx
+on :SCHEMA.dead_letters (dropped_at);
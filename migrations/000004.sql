@@ -0,0 +1,17 @@
+-- a history of the delivery attempts of each message
+create table :SCHEMA.delivery_attempts (
+  id bigserial primary key,
+  event_id bigint not null references :SCHEMA.events (id) on delete cascade,
+  attempt integer not null,
+  started_at timestamptz not null,
+  finished_at timestamptz not null,
+  outcome text not null,
+  error text,
+  retry_at timestamptz,
+
+  constraint delivery_attempts_outcome_check check (outcome in ('processed', 'retry', 'dropped'))
+);
+
+-- an index for listing the delivery attempts of a specific message
+create index delivery_attempts_event_id_attempt_idx
+on :SCHEMA.delivery_attempts (event_id, attempt);
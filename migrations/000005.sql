@@ -0,0 +1,12 @@
+-- the time a message reached a terminal status, used for removing old messages
+alter table :SCHEMA.events
+  add column finished_at timestamptz;
+
+update :SCHEMA.events
+set finished_at = deliver_at
+where status <> 'pending';
+
+-- an index for finding the messages which have been in a terminal status for long enough
+create index events_status_finished_at_idx
+on :SCHEMA.events (status, finished_at)
+where status <> 'pending';
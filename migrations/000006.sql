@@ -0,0 +1,9 @@
+-- the correlation and causation ids of a message, used for following the chains of messages
+alter table :SCHEMA.events
+  add column correlation_id text,
+  add column causation_id text;
+
+-- an index for finding every message of a chain
+create index events_correlation_id_idx
+on :SCHEMA.events (correlation_id)
+where correlation_id is not null;
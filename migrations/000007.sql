@@ -0,0 +1,3 @@
+-- the content type of the payload of a message, the existing messages are all JSON
+alter table :SCHEMA.events
+  add column content_type text not null default 'application/json';
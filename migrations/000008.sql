@@ -0,0 +1,15 @@
+-- the keys of the messages which have already been handled, used for skipping the duplicate deliveries
+create table :SCHEMA.idempotency_keys (
+  queue text not null,
+  key text not null,
+  recorded_at timestamptz not null default now(),
+  expires_at timestamptz,
+  -- a key is claimed until `claimed_until` while its delivery is being handled, and the claim is cleared once recorded
+  claimed_until timestamptz,
+  primary key (queue, key)
+);
+
+-- an index for removing the expired keys
+create index idempotency_keys_expires_at_idx
+on :SCHEMA.idempotency_keys (expires_at)
+where expires_at is not null;
@@ -0,0 +1,8 @@
+-- the ordering key of a message, the messages with the same key are handled one at a time per queue
+alter table :SCHEMA.events
+  add column ordering_key text;
+
+-- an index for finding the earlier pending messages of an ordering key
+create index events_queue_ordering_key_idx
+on :SCHEMA.events (queue, ordering_key, id)
+where status = 'pending' and ordering_key is not null;
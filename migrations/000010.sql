@@ -0,0 +1,31 @@
+-- the priority of a message, the messages with a higher priority are handled first on a queue
+alter table :SCHEMA.events
+  add column priority integer not null default 0;
+
+-- the order in which the pending messages are claimed on a queue: the time a message is due, moved a minute earlier
+-- for every level of priority. The higher priorities are served first, while a message which has waited for long
+-- enough overtakes them. Unlike a priority aged at claim time, this order can be served from an index.
+alter table :SCHEMA.events
+  add column claim_at timestamptz;
+
+update :SCHEMA.events
+set claim_at = deliver_at;
+
+alter table :SCHEMA.events
+  alter column claim_at set not null;
+
+create function :SCHEMA.set_claim_at() returns trigger as $$
+begin
+  new.claim_at = new.deliver_at - new.priority * interval '1 minute';
+  return new;
+end;
+$$ language plpgsql;
+
+create trigger set_claim_at_trigger before insert or update of deliver_at, priority on :SCHEMA.events
+for each row execute procedure :SCHEMA.set_claim_at();
+
+-- an index for claiming the pending messages of a queue in order, which replaces the index ordered by publish time
+drop index :SCHEMA.events_status_queue_published_at_idx;
+
+create index events_status_queue_claim_at_idx
+on :SCHEMA.events (status, queue, claim_at, id);
@@ -0,0 +1,14 @@
+-- the time after which a message is no longer delivered but marked as `expired`
+alter table :SCHEMA.events
+  add column expires_at timestamptz;
+
+alter table :SCHEMA.events
+  drop constraint events_status_check;
+
+alter table :SCHEMA.events
+  add constraint events_status_check check (status in ('pending', 'processed', 'dropped', 'expired'));
+
+-- an index for finding the pending messages which have expired
+create index events_expires_at_idx
+on :SCHEMA.events (expires_at)
+where status = 'pending' and expires_at is not null;
@@ -2,6 +2,7 @@ package opinionatedevents
 
 import (
 	"context"
+	"database/sql"
 	"strings"
 )
 
@@ -9,6 +10,13 @@ func WithTx(ctx context.Context, tx sqlTx) context.Context {
 	return context.WithValue(ctx, postgresContextKeyForTx, tx)
 }
 
+// TxFromContext returns the transaction of the context, e.g. the transaction of a handler run with
+// `PostgresSourceWithTransactionalHandlers`.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(postgresContextKeyForTx).(*sql.Tx)
+	return tx, ok
+}
+
 func withSchema(query string, schema string) string {
 	return strings.ReplaceAll(query, ":SCHEMA", schema)
 }
@@ -4,9 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"reflect"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type onDeliveryFailureHandler struct {
@@ -16,7 +20,12 @@ type onDeliveryFailureHandler struct {
 type Publisher struct {
 	bridge                    bridge
 	inFlightWaitingGroup      sync.WaitGroup
+	logger                    *slog.Logger
+	metrics                   Metrics
 	onDeliveryFailureHandlers []*onDeliveryFailureHandler
+	keys                      KeyProvider
+	schemas                   *SchemaRegistry
+	tracer                    trace.Tracer
 }
 
 type publisherOption func(p *Publisher) error
@@ -45,11 +54,72 @@ func PublisherWithAsyncBridge(
 	}
 }
 
+// PublisherWithLogger sets the logger used for reporting failed deliveries, defaults to `slog.Default()`.
+func PublisherWithLogger(logger *slog.Logger) publisherOption {
+	return func(p *Publisher) error {
+		if logger == nil {
+			return errors.New("logger cannot be nil")
+		}
+		p.logger = logger
+		return nil
+	}
+}
+
+// PublisherWithMetrics sets where the measurements of the published messages are reported, disabled by default.
+func PublisherWithMetrics(metrics Metrics) publisherOption {
+	return func(p *Publisher) error {
+		if metrics == nil {
+			return errors.New("metrics cannot be nil")
+		}
+		p.metrics = metrics
+		return nil
+	}
+}
+
+// PublisherWithTracerProvider sets the provider of the publish spans, defaults to `otel.GetTracerProvider()`. The trace
+// context is serialized into the messages with `otel.GetTextMapPropagator()`.
+func PublisherWithTracerProvider(provider trace.TracerProvider) publisherOption {
+	return func(p *Publisher) error {
+		if provider == nil {
+			return errors.New("tracer provider cannot be nil")
+		}
+		p.tracer = newTracer(provider)
+		return nil
+	}
+}
+
+// PublisherWithSchemaRegistry validates the payloads against their schemas before they are published. A batch with an
+// invalid payload is rejected with a `*SchemaValidationError` and none of its messages are published.
+func PublisherWithSchemaRegistry(registry *SchemaRegistry) publisherOption {
+	return func(p *Publisher) error {
+		if registry == nil {
+			return errors.New("schema registry cannot be nil")
+		}
+		p.schemas = registry
+		return nil
+	}
+}
+
+// PublisherWithEncryption encrypts the payloads with AES-GCM before they are published, using the current key of the
+// key provider. The messages given to the publisher are left as is, the destinations receive encrypted copies.
+func PublisherWithEncryption(keys KeyProvider) publisherOption {
+	return func(p *Publisher) error {
+		if keys == nil {
+			return errors.New("key provider cannot be nil")
+		}
+		p.keys = keys
+		return nil
+	}
+}
+
 func NewPublisher(opts ...publisherOption) (*Publisher, error) {
 	publisher := &Publisher{
 		bridge:                    nil,
 		inFlightWaitingGroup:      sync.WaitGroup{},
+		logger:                    slog.Default(),
+		metrics:                   &noopMetrics{},
 		onDeliveryFailureHandlers: []*onDeliveryFailureHandler{},
+		tracer:                    newTracer(otel.GetTracerProvider()),
 	}
 	for _, apply := range opts {
 		if err := apply(publisher); err != nil {
@@ -59,6 +129,8 @@ func NewPublisher(opts ...publisherOption) (*Publisher, error) {
 	if publisher.bridge == nil {
 		return nil, errors.New("publisher bridge was not configured")
 	}
+	publisher.bridge.setLogger(publisher.logger)
+	publisher.bridge.setMetrics(publisher.metrics)
 	return publisher, nil
 }
 
@@ -86,6 +158,13 @@ func (p *Publisher) PublishMany(ctx context.Context, batch []*Message) error {
 }
 
 func (p *Publisher) publish(ctx context.Context, batch []*Message) error {
+	if p.schemas != nil {
+		for _, msg := range batch {
+			if err := p.schemas.Validate(msg); err != nil {
+				return err
+			}
+		}
+	}
 	for _, msg := range batch {
 		if msg.publishedAt.IsZero() {
 			msg.publishedAt = time.Now()
@@ -94,27 +173,41 @@ func (p *Publisher) publish(ctx context.Context, batch []*Message) error {
 			msg.deliverAt = msg.publishedAt
 		}
 	}
+	propagateCausation(ctx, batch)
+	ctx, span := startPublishSpan(ctx, p.tracer, batch)
+	toBePublished, err := p.encrypt(ctx, batch)
+	if err != nil {
+		endSpan(span, err)
+		return err
+	}
 	p.inFlightWaitingGroup.Add(1)
-	envelope := p.bridge.take(ctx, batch)
+	envelope := p.bridge.take(ctx, toBePublished)
 	// FIXME: this entire `isClosed` is fucked up, eg. there is no way to extract the actual error...
 	if envelope.isClosed() {
 		// the envelope was closed synchronously -> handle result synchronously
 		p.inFlightWaitingGroup.Done()
 		if envelope.isClosedWith(deliveryEventFailureName) {
+			err := fmt.Errorf("error publishing a batch of messages: %#v", batch)
+			endSpan(span, err)
+			p.logFailure(ctx, batch)
 			for _, handleFailure := range p.onDeliveryFailureHandlers {
 				handleFailure.handler(batch)
 			}
-			return fmt.Errorf("error publishing a batch of messages: %#v", batch)
+			return err
 		}
+		endSpan(span, nil)
 		return nil
 	}
 	// the envelope will be closed asynchronously -> return nil error
 	go func() {
 		select {
 		case <-envelope.onSuccess():
+			endSpan(span, nil)
 			p.inFlightWaitingGroup.Done()
 		case <-envelope.onFailure():
+			endSpan(span, errors.New("error publishing a batch of messages"))
 			p.inFlightWaitingGroup.Done()
+			p.logFailure(ctx, batch)
 			for _, handleFailure := range p.onDeliveryFailureHandlers {
 				handleFailure.handler(batch)
 			}
@@ -123,6 +216,27 @@ func (p *Publisher) publish(ctx context.Context, batch []*Message) error {
 	return nil
 }
 
+// encrypt returns the encrypted copies of the messages, or the messages as is if encryption is not enabled
+func (p *Publisher) encrypt(ctx context.Context, batch []*Message) ([]*Message, error) {
+	if p.keys == nil {
+		return batch, nil
+	}
+	encrypted := make([]*Message, len(batch))
+	for i, msg := range batch {
+		var err error
+		if encrypted[i], err = encryptMessage(ctx, p.keys, msg); err != nil {
+			return nil, fmt.Errorf("failed to encrypt the payload: %w", err)
+		}
+	}
+	return encrypted, nil
+}
+
+func (p *Publisher) logFailure(ctx context.Context, batch []*Message) {
+	for _, msg := range batch {
+		p.logger.ErrorContext(ctx, "failed to publish a message", messageLogAttrs(msg)...)
+	}
+}
+
 func (p *Publisher) Drain() {
 	p.inFlightWaitingGroup.Wait()
 }
@@ -4,6 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Delivery interface {
@@ -15,9 +21,17 @@ type Delivery interface {
 type OnMessageHandler func(ctx context.Context, delivery Delivery) error
 
 type Receiver struct {
+	logger    *slog.Logger
+	metrics   Metrics
 	started   bool
 	sources   []Source
+	keys      KeyProvider
 	onMessage map[string]map[string]OnMessageHandler
+	schemas   *SchemaRegistry
+	timeouts  map[string]time.Duration
+	tracer    trace.Tracer
+	upcasters *UpcasterRegistry
+	versions  map[string]map[string]int
 }
 
 type receiverOption func(r *Receiver) error
@@ -29,11 +43,98 @@ func ReceiverWithSource(source Source) receiverOption {
 	}
 }
 
+// ReceiverWithQueueTimeout cancels the context of every handler of the queue after the given duration. A handler
+// which returns an error after timing out is retried later on, unless a middleware (e.g. `WithLimit`) made it fatal.
+func ReceiverWithQueueTimeout(queue string, timeout time.Duration) receiverOption {
+	return func(r *Receiver) error {
+		if timeout <= 0 {
+			return errors.New("timeout must be positive")
+		}
+		r.timeouts[queue] = timeout
+		return nil
+	}
+}
+
+// ReceiverWithLogger sets the logger used for reporting failed deliveries, defaults to `slog.Default()`.
+func ReceiverWithLogger(logger *slog.Logger) receiverOption {
+	return func(r *Receiver) error {
+		if logger == nil {
+			return errors.New("logger cannot be nil")
+		}
+		r.logger = logger
+		return nil
+	}
+}
+
+// ReceiverWithMetrics sets where the measurements of the deliveries are reported, disabled by default.
+func ReceiverWithMetrics(metrics Metrics) receiverOption {
+	return func(r *Receiver) error {
+		if metrics == nil {
+			return errors.New("metrics cannot be nil")
+		}
+		r.metrics = metrics
+		return nil
+	}
+}
+
+// ReceiverWithTracerProvider sets the provider of the process spans, defaults to `otel.GetTracerProvider()`. The trace
+// context of the publisher is restored from the messages with `otel.GetTextMapPropagator()`.
+func ReceiverWithTracerProvider(provider trace.TracerProvider) receiverOption {
+	return func(r *Receiver) error {
+		if provider == nil {
+			return errors.New("tracer provider cannot be nil")
+		}
+		r.tracer = newTracer(provider)
+		return nil
+	}
+}
+
+// ReceiverWithSchemaRegistry validates the payloads against their schemas before they are handled. A message with an
+// invalid payload is dropped without calling the handler, with the `*SchemaValidationError` as the reason.
+func ReceiverWithSchemaRegistry(registry *SchemaRegistry) receiverOption {
+	return func(r *Receiver) error {
+		if registry == nil {
+			return errors.New("schema registry cannot be nil")
+		}
+		r.schemas = registry
+		return nil
+	}
+}
+
+// ReceiverWithEncryption decrypts the encrypted payloads before they are handled, with the keys of the key provider.
+// The payloads which are not encrypted are handled as is.
+func ReceiverWithEncryption(keys KeyProvider) receiverOption {
+	return func(r *Receiver) error {
+		if keys == nil {
+			return errors.New("key provider cannot be nil")
+		}
+		r.keys = keys
+		return nil
+	}
+}
+
+// ReceiverWithUpcasters upcasts the payloads of the older versions to the version expected by the handler (see
+// `Receiver.OnVersion`), or to the latest version of the message, before they are handled.
+func ReceiverWithUpcasters(registry *UpcasterRegistry) receiverOption {
+	return func(r *Receiver) error {
+		if registry == nil {
+			return errors.New("upcaster registry cannot be nil")
+		}
+		r.upcasters = registry
+		return nil
+	}
+}
+
 func NewReceiver(opts ...receiverOption) (*Receiver, error) {
 	receiver := &Receiver{
+		logger:    slog.Default(),
+		metrics:   &noopMetrics{},
 		started:   false,
 		sources:   []Source{},
 		onMessage: map[string]map[string]OnMessageHandler{},
+		timeouts:  map[string]time.Duration{},
+		tracer:    newTracer(otel.GetTracerProvider()),
+		versions:  map[string]map[string]int{},
 	}
 	for _, apply := range opts {
 		if err := apply(receiver); err != nil {
@@ -56,6 +157,45 @@ func (r *Receiver) Start(ctx context.Context) error {
 	return nil
 }
 
+// Stop stops every source from receiving new messages and waits for the in-flight deliveries until the context is
+// done. The deliveries which did not finish in time are reported with an `*UnfinishedDeliveriesError`. The sources
+// which do not implement `Stop(ctx context.Context) error` are skipped.
+func (r *Receiver) Stop(ctx context.Context) error {
+	if !r.started {
+		return errors.New("cannot stop a receiver which has not been started")
+	}
+	// stop the sources concurrently so that they all stop receiving new messages right away
+	errs := make([]error, len(r.sources))
+	var wg sync.WaitGroup
+	for i, source := range r.sources {
+		stoppable, ok := source.(stoppableSource)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = stoppable.Stop(ctx)
+		}()
+	}
+	wg.Wait()
+	// combine the unfinished deliveries from every source into a single error
+	unfinished := &UnfinishedDeliveriesError{Deliveries: []Delivery{}}
+	otherErrs := []error{}
+	for _, err := range errs {
+		var unfinishedErr *UnfinishedDeliveriesError
+		if errors.As(err, &unfinishedErr) {
+			unfinished.Deliveries = append(unfinished.Deliveries, unfinishedErr.Deliveries...)
+		} else if err != nil {
+			otherErrs = append(otherErrs, err)
+		}
+	}
+	if len(unfinished.Deliveries) > 0 {
+		otherErrs = append(otherErrs, unfinished)
+	}
+	return errors.Join(otherErrs...)
+}
+
 func (r *Receiver) GetQueuesWithHandlers() []string {
 	result := []string{}
 	for queue := range r.onMessage {
@@ -81,7 +221,16 @@ func (r *Receiver) Deliver(ctx context.Context, delivery Delivery) error {
 	queue, msg := delivery.GetQueue(), delivery.GetMessage()
 	if onMessageForQueue, ok := r.onMessage[queue]; ok {
 		if onMessageHandler, ok := onMessageForQueue[msg.name]; ok {
-			return onMessageHandler(ctx, delivery)
+			ctx = withCausingMessage(ctx, msg)
+			ctx, span := startProcessSpan(ctx, r.tracer, delivery)
+			startedAt := time.Now()
+			err := r.handle(ctx, onMessageHandler, delivery)
+			r.recordMetrics(delivery, err, time.Since(startedAt))
+			endSpan(span, err)
+			if err != nil {
+				r.logFailure(ctx, delivery, err)
+			}
+			return err
 		}
 	}
 	err := fmt.Errorf(
@@ -91,6 +240,124 @@ func (r *Receiver) Deliver(ctx context.Context, delivery Delivery) error {
 	panic(err)
 }
 
+func (r *Receiver) handle(ctx context.Context, onMessageHandler OnMessageHandler, delivery Delivery) error {
+	delivery, err := r.decrypt(ctx, delivery)
+	if err != nil {
+		return err
+	}
+	if delivery, err = r.upcast(delivery); err != nil {
+		return err
+	}
+	if r.schemas != nil {
+		if err := r.schemas.Validate(delivery.GetMessage()); err != nil {
+			return Fatal(err)
+		}
+	}
+	timeout, ok := r.timeouts[delivery.GetQueue()]
+	if !ok {
+		return onMessageHandler(ctx, delivery)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err = onMessageHandler(ctx, delivery)
+	if err != nil && !IsFatal(err) && !errors.Is(err, ErrTimeout) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %w", ErrTimeout, timeout, err)
+	}
+	return err
+}
+
+// decrypt returns the delivery with the payload of the message decrypted
+func (r *Receiver) decrypt(ctx context.Context, delivery Delivery) (Delivery, error) {
+	msg := delivery.GetMessage()
+	if msg.encryption == nil {
+		return delivery, nil
+	}
+	if r.keys == nil {
+		return nil, Fatal(fmt.Errorf(`cannot decrypt message "%s" with no key provider`, msg.GetName()))
+	}
+	decrypted, err := decryptMessage(ctx, r.keys, msg)
+	if err != nil {
+		return nil, err
+	}
+	return withMessage(delivery, decrypted), nil
+}
+
+// upcast returns the delivery with the message upcasted to the version expected by the handler. A message which is
+// newer than the handler is retried, so that it is not lost before the consumer is upgraded.
+func (r *Receiver) upcast(delivery Delivery) (Delivery, error) {
+	msg := delivery.GetMessage()
+	version, ok := r.versions[delivery.GetQueue()][msg.GetName()]
+	if !ok {
+		if r.upcasters == nil {
+			return delivery, nil
+		}
+		version = max(r.upcasters.Latest(msg.GetName()), msg.GetVersion())
+	}
+	if msg.GetVersion() == version {
+		return delivery, nil
+	}
+	if msg.GetVersion() > version {
+		return nil, fmt.Errorf(
+			`handler of message "%s" expects version %d, got a newer version %d`, msg.GetName(), version, msg.GetVersion(),
+		)
+	}
+	if r.upcasters == nil {
+		return nil, Fatal(fmt.Errorf(`cannot upcast message "%s" with no upcasters`, msg.GetName()))
+	}
+	upcasted, err := r.upcasters.Upcast(msg, version)
+	if err != nil {
+		return nil, Fatal(err)
+	}
+	return withMessage(delivery, upcasted), nil
+}
+
+func (r *Receiver) recordMetrics(delivery Delivery, err error, duration time.Duration) {
+	queue, name := delivery.GetQueue(), delivery.GetMessage().GetName()
+	outcome := "processed"
+	if IsFatal(err) {
+		outcome = "dropped"
+	} else if err != nil {
+		outcome = "retry"
+	}
+	r.metrics.AddCounter(MetricDeliveries, Labels{"queue": queue, "name": name, "outcome": outcome}, 1)
+	r.metrics.ObserveHistogram(MetricHandlerDuration, Labels{"queue": queue, "name": name}, duration.Seconds())
+}
+
+func (r *Receiver) logFailure(ctx context.Context, delivery Delivery, err error) {
+	attrs := append(deliveryLogAttrs(delivery), "error", err)
+	if IsFatal(err) {
+		r.logger.ErrorContext(ctx, "failed to handle a message, dropping it", attrs...)
+		return
+	}
+	var retryErr *retryError
+	if errors.As(err, &retryErr) {
+		attrs = append(attrs, "retry_at", retryErr.retryAt)
+	}
+	r.logger.WarnContext(ctx, "failed to handle a message, retrying it later", attrs...)
+}
+
+// withMessage returns the delivery with its message replaced, e.g. with the decrypted or the upcasted message
+func withMessage(delivery Delivery, msg *Message) Delivery {
+	return &messageDelivery{Delivery: delivery, msg: msg}
+}
+
+type messageDelivery struct {
+	Delivery
+	msg *Message
+}
+
+func (d *messageDelivery) GetMessage() *Message {
+	return d.msg
+}
+
+// deliveryLogAttrs returns the structured logging fields which identify the delivery
+func deliveryLogAttrs(delivery Delivery) []any {
+	return append(messageLogAttrs(delivery.GetMessage()),
+		"queue", delivery.GetQueue(),
+		"attempt", delivery.GetAttempt(),
+	)
+}
+
 func (r *Receiver) On(queue string, name string, onMessage OnMessageHandler) error {
 	if _, ok := r.onMessage[queue]; !ok {
 		r.onMessage[queue] = map[string]OnMessageHandler{}
@@ -101,3 +368,19 @@ func (r *Receiver) On(queue string, name string, onMessage OnMessageHandler) err
 	r.onMessage[queue][name] = onMessage
 	return nil
 }
+
+// OnVersion is like `On`, but the handler declares the version of the payload it expects. The older versions are
+// upcasted to it with the upcasters of the receiver, see `ReceiverWithUpcasters`.
+func (r *Receiver) OnVersion(queue string, name string, version int, onMessage OnMessageHandler) error {
+	if version < 1 {
+		return errors.New("version must be at least 1")
+	}
+	if err := r.On(queue, name, onMessage); err != nil {
+		return err
+	}
+	if _, ok := r.versions[queue]; !ok {
+		r.versions[queue] = map[string]int{}
+	}
+	r.versions[queue][name] = version
+	return nil
+}
@@ -1,10 +1,13 @@
 package opinionatedevents
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -95,6 +98,69 @@ func TestReceiver(t *testing.T) {
 	}
 }
 
+func TestReceiverWithQueueTimeout(t *testing.T) {
+	receiver, err := NewReceiver(ReceiverWithQueueTimeout("slow", 10*time.Millisecond))
+	assert.NoError(t, err)
+	handler := func(ctx context.Context, _ Delivery) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	assert.NoError(t, receiver.On("slow", "test.test", handler))
+	assert.NoError(t, receiver.On("fast", "test.test", func(ctx context.Context, _ Delivery) error {
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+		return nil
+	}))
+	assert.NoError(t, receiver.Start(context.Background()))
+	msg, err := NewMessage("test.test", nil)
+	assert.NoError(t, err)
+	result := receiver.Deliver(context.Background(), &testDelivery{1, "slow", msg})
+	assert.ErrorIs(t, result, ErrTimeout)
+	assert.False(t, IsFatal(result))
+	assert.NoError(t, receiver.Deliver(context.Background(), &testDelivery{1, "fast", msg}))
+}
+
+func TestReceiverWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	receiver, err := NewReceiver(ReceiverWithLogger(logger))
+	assert.NoError(t, err)
+	assert.NoError(t, receiver.On("test", "test.test", func(_ context.Context, _ Delivery) error {
+		return Fatal(errors.New("just a test"))
+	}))
+	assert.NoError(t, receiver.Start(context.Background()))
+	msg, err := NewMessage("test.test", nil)
+	assert.NoError(t, err)
+	assert.Error(t, receiver.Deliver(context.Background(), &testDelivery{2, "test", msg}))
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "test", record["queue"])
+	assert.Equal(t, "test.test", record["name"])
+	assert.Equal(t, msg.GetUUID(), record["uuid"])
+	assert.Equal(t, float64(2), record["attempt"])
+	assert.Equal(t, "fatal: just a test", record["error"])
+}
+
+func TestReceiverStopWithStartOnlySource(t *testing.T) {
+	// the sources implemented before `Stop` existed must keep working
+	source := &testStartOnlySource{}
+	receiver, err := NewReceiver(ReceiverWithSource(source))
+	assert.NoError(t, err)
+	assert.NoError(t, receiver.Start(context.Background()))
+	assert.True(t, source.started)
+	assert.NoError(t, receiver.Stop(context.Background()))
+}
+
+type testStartOnlySource struct {
+	started bool
+}
+
+func (s *testStartOnlySource) Start(_ context.Context, _ *Receiver) error {
+	s.started = true
+	return nil
+}
+
 func makeOnMessageHandler(name string, log *[]string, returnsErr bool) OnMessageHandler {
 	return func(_ context.Context, _ Delivery) error {
 		*log = append(*log, name)
@@ -0,0 +1,114 @@
+package opinionatedevents
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// SchemaValidationError is returned when the payload of a message does not conform to the schema of the message.
+type SchemaValidationError struct {
+	Name string
+	Err  error
+}
+
+func (e *SchemaValidationError) Error() string {
+	return fmt.Sprintf(`payload of message "%s" does not conform to its schema: %s`, e.Name, e.Err.Error())
+}
+
+func (e *SchemaValidationError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaRegistry holds the JSON Schemas of the payloads, keyed by the message name.
+type SchemaRegistry struct {
+	schemas map[string]*jsonschema.Schema
+}
+
+// NewSchemaRegistry compiles every `<message name>.json` file of the file system, in any directory, as the JSON Schema
+// of the payload of that message, e.g. `schemas/customers.created.json` for `customers.created`. The schemas can refer
+// to each other with relative `$ref`s.
+func NewSchemaRegistry(fsys fs.FS) (*SchemaRegistry, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.UseLoader(&schemaLoader{fsys: fsys})
+	registry := &SchemaRegistry{schemas: map[string]*jsonschema.Schema{}}
+	err := fs.WalkDir(fsys, ".", func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || path.Ext(filePath) != ".json" {
+			return nil
+		}
+		name := strings.TrimSuffix(path.Base(filePath), ".json")
+		if _, ok := registry.schemas[name]; ok {
+			return fmt.Errorf(`more than one schema for message "%s"`, name)
+		}
+		schema, err := compiler.Compile(schemaURL(filePath))
+		if err != nil {
+			return fmt.Errorf(`failed to compile the schema of message "%s": %w`, name, err)
+		}
+		registry.schemas[name] = schema
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// Validate checks the payload of the message against the schema of the message. A message with no schema is always
+// valid, and a message with a schema must have a JSON payload.
+func (r *SchemaRegistry) Validate(msg *Message) error {
+	schema, ok := r.schemas[msg.GetName()]
+	if !ok {
+		return nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(msg.GetContentType()); mediaType != JSONCodec.ContentType() {
+		return &SchemaValidationError{
+			Name: msg.GetName(),
+			Err:  fmt.Errorf("content type %q cannot be validated", msg.GetContentType()),
+		}
+	}
+	payload := msg.payload
+	if len(payload) == 0 {
+		payload = []byte("null")
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(payload))
+	if err != nil {
+		return &SchemaValidationError{Name: msg.GetName(), Err: err}
+	}
+	if err := schema.Validate(instance); err != nil {
+		return &SchemaValidationError{Name: msg.GetName(), Err: err}
+	}
+	return nil
+}
+
+// loading the schemas from a file system
+// ---
+
+const schemaURLPrefix string = "file:///"
+
+func schemaURL(filePath string) string {
+	return schemaURLPrefix + filePath
+}
+
+type schemaLoader struct {
+	fsys fs.FS
+}
+
+func (l *schemaLoader) Load(url string) (any, error) {
+	if !strings.HasPrefix(url, schemaURLPrefix) {
+		return nil, fmt.Errorf("cannot load schema %s outside of the file system", url)
+	}
+	file, err := l.fsys.Open(strings.TrimPrefix(url, schemaURLPrefix))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return jsonschema.UnmarshalJSON(file)
+}
@@ -0,0 +1,121 @@
+package opinionatedevents
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSchemas = fstest.MapFS{
+	"schemas/customers.created.json": &fstest.MapFile{Data: []byte(`{
+		"type": "object",
+		"properties": {"id": {"type": "string"}, "address": {"$ref": "common/address.json"}},
+		"required": ["id"]
+	}`)},
+	"schemas/common/address.json": &fstest.MapFile{Data: []byte(`{
+		"type": "object",
+		"properties": {"city": {"type": "string"}},
+		"required": ["city"]
+	}`)},
+	"README.md": &fstest.MapFile{Data: []byte("not a schema")},
+}
+
+func TestSchemaRegistry(t *testing.T) {
+	registry, err := NewSchemaRegistry(testSchemas)
+	assert.NoError(t, err)
+
+	t.Run("validates the payloads against the schema of the message", func(t *testing.T) {
+		for _, tc := range []struct {
+			payload any
+			valid   bool
+		}{
+			{payload: map[string]any{"id": "1"}, valid: true},
+			{payload: map[string]any{"id": "1", "address": map[string]any{"city": "Helsinki"}}, valid: true},
+			{payload: map[string]any{"id": 1}, valid: false},
+			{payload: map[string]any{"id": "1", "address": map[string]any{}}, valid: false},
+			{payload: nil, valid: false},
+		} {
+			msg, err := NewMessage("customers.created", tc.payload)
+			assert.NoError(t, err)
+			err = registry.Validate(msg)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				var validationErr *SchemaValidationError
+				assert.ErrorAs(t, err, &validationErr)
+				assert.Equal(t, "customers.created", validationErr.Name)
+			}
+		}
+	})
+
+	t.Run("accepts any payload of a message with no schema", func(t *testing.T) {
+		msg, err := NewMessage("customers.deleted", "anything")
+		assert.NoError(t, err)
+		assert.NoError(t, registry.Validate(msg))
+	})
+
+	t.Run("rejects a payload which is not json", func(t *testing.T) {
+		msg, err := NewMessage("customers.created", map[string]any{"id": "1"}, WithCodec(MsgpackCodec))
+		assert.NoError(t, err)
+		assert.ErrorContains(t, registry.Validate(msg), "cannot be validated")
+	})
+
+	t.Run("fails to load an invalid schema", func(t *testing.T) {
+		_, err := NewSchemaRegistry(fstest.MapFS{
+			"customers.created.json": &fstest.MapFile{Data: []byte(`{"type": 42}`)},
+		})
+		assert.ErrorContains(t, err, "customers.created")
+	})
+}
+
+func TestPublisherWithSchemaRegistry(t *testing.T) {
+	registry, err := NewSchemaRegistry(testSchemas)
+	assert.NoError(t, err)
+	delivered := 0
+	destination := newTestDestination()
+	destination.pushHandler(func(_ context.Context, batch []*Message) error {
+		delivered += len(batch)
+		return nil
+	})
+	publisher, err := NewPublisher(
+		PublisherWithSyncBridge(destination),
+		PublisherWithSchemaRegistry(registry),
+	)
+	assert.NoError(t, err)
+	valid, err := NewMessage("customers.created", map[string]any{"id": "1"})
+	assert.NoError(t, err)
+	invalid, err := NewMessage("customers.created", map[string]any{"id": 1})
+	assert.NoError(t, err)
+	err = publisher.PublishMany(context.Background(), []*Message{valid, invalid})
+	var validationErr *SchemaValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, 0, delivered)
+	assert.NoError(t, publisher.PublishOne(context.Background(), valid))
+	assert.Equal(t, 1, delivered)
+}
+
+func TestReceiverWithSchemaRegistry(t *testing.T) {
+	registry, err := NewSchemaRegistry(testSchemas)
+	assert.NoError(t, err)
+	receiver, err := NewReceiver(ReceiverWithSchemaRegistry(registry))
+	assert.NoError(t, err)
+	handled := 0
+	assert.NoError(t, receiver.On("default", "customers.created", func(_ context.Context, _ Delivery) error {
+		handled += 1
+		return nil
+	}))
+	assert.NoError(t, receiver.Start(context.Background()))
+	valid, err := NewMessage("customers.created", map[string]any{"id": "1"})
+	assert.NoError(t, err)
+	assert.NoError(t, receiver.Deliver(context.Background(), &testDelivery{1, "default", valid}))
+	invalid, err := NewMessage("customers.created", map[string]any{"id": 1})
+	assert.NoError(t, err)
+	err = receiver.Deliver(context.Background(), &testDelivery{1, "default", invalid})
+	assert.True(t, IsFatal(err))
+	var validationErr *SchemaValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, 1, handled)
+}
@@ -1,15 +1,5 @@
 package opinionatedevents
 
-func filter[V any](collection []V, predicate func(item V, index int) bool) []V {
-	result := make([]V, 0, len(collection))
-	for i, item := range collection {
-		if predicate(item, i) {
-			result = append(result, item)
-		}
-	}
-	return result
-}
-
 func groupIntoBatches[T any](arr []T, batchSize int) [][]T {
 	if len(arr) == 0 {
 		return [][]T{}
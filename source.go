@@ -1,7 +1,83 @@
 package opinionatedevents
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"sync"
+)
 
 type Source interface {
 	Start(ctx context.Context, receiver *Receiver) error
 }
+
+// stoppableSource is implemented by the sources which can be stopped gracefully, see `Receiver.Stop`
+type stoppableSource interface {
+	// Stop stops receiving new messages and waits for the in-flight deliveries until the context is done.
+	Stop(ctx context.Context) error
+}
+
+// UnfinishedDeliveriesError is returned when stopping if some of the deliveries did not finish in time.
+type UnfinishedDeliveriesError struct {
+	Deliveries []Delivery
+}
+
+func (e *UnfinishedDeliveriesError) Error() string {
+	return fmt.Sprintf("%d delivery(ies) did not finish before stopping", len(e.Deliveries))
+}
+
+// in-flight deliveries
+// ---
+
+type inFlightDeliveries struct {
+	deliveries map[Delivery]struct{}
+	mutex      sync.Mutex
+	changed    chan struct{}
+}
+
+func newInFlightDeliveries() *inFlightDeliveries {
+	return &inFlightDeliveries{
+		deliveries: map[Delivery]struct{}{},
+		changed:    make(chan struct{}, 1),
+	}
+}
+
+func (f *inFlightDeliveries) add(delivery Delivery) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.deliveries[delivery] = struct{}{}
+}
+
+func (f *inFlightDeliveries) remove(delivery Delivery) {
+	f.mutex.Lock()
+	delete(f.deliveries, delivery)
+	f.mutex.Unlock()
+	select {
+	case f.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (f *inFlightDeliveries) list() []Delivery {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	deliveries := make([]Delivery, 0, len(f.deliveries))
+	for delivery := range f.deliveries {
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries
+}
+
+// wait waits until there are no deliveries in-flight, or returns the unfinished ones if the context is done first
+func (f *inFlightDeliveries) wait(ctx context.Context) []Delivery {
+	for {
+		deliveries := f.list()
+		if len(deliveries) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return deliveries
+		case <-f.changed:
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package opinionatedevents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// http delivery
+// ---
+
+type httpDelivery struct {
+	queue   string
+	attempt int
+	message *Message
+}
+
+func newHTTPDelivery(queue string, message *Message) *httpDelivery {
+	// NOTE: the sender does not keep track of the attempts, every delivery is considered the first one
+	return &httpDelivery{queue: queue, attempt: 1, message: message}
+}
+
+func (d *httpDelivery) GetAttempt() int {
+	return d.attempt
+}
+
+func (d *httpDelivery) GetQueue() string {
+	return d.queue
+}
+
+func (d *httpDelivery) GetMessage() *Message {
+	return d.message
+}
+
+// http source
+// ---
+
+type httpSource struct {
+	ctx          context.Context
+	cancel       context.CancelFunc
+	inFlight     *inFlightDeliveries
+	queue        string
+	receiver     *Receiver
+	receiverLock sync.RWMutex
+	stopped      bool
+}
+
+type httpSourceOption func(source *httpSource) error
+
+// HTTPSourceWithQueue sets the queue used when the route does not have a `{queue}` path value.
+func HTTPSourceWithQueue(queue string) httpSourceOption {
+	return func(source *httpSource) error {
+		source.queue = queue
+		return nil
+	}
+}
+
+func NewHTTPSource(options ...httpSourceOption) (*httpSource, error) {
+	source := &httpSource{inFlight: newInFlightDeliveries(), queue: ""}
+	for _, apply := range options {
+		if err := apply(source); err != nil {
+			return nil, err
+		}
+	}
+	return source, nil
+}
+
+func (s *httpSource) Start(ctx context.Context, receiver *Receiver) error {
+	s.receiverLock.Lock()
+	defer s.receiverLock.Unlock()
+	if s.receiver != nil {
+		return fmt.Errorf("cannot start a source more than once")
+	}
+	s.receiver = receiver
+	// the context of the deliveries is cancelled with the source's context, or when `Stop` runs out of time
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	return nil
+}
+
+func (s *httpSource) Stop(ctx context.Context) error {
+	s.receiverLock.Lock()
+	if s.receiver == nil {
+		s.receiverLock.Unlock()
+		return fmt.Errorf("cannot stop a source which has not been started")
+	}
+	s.stopped = true
+	s.receiverLock.Unlock()
+	// new requests are rejected from now on, wait for the in-flight deliveries to finish
+	if unfinished := s.inFlight.wait(ctx); len(unfinished) > 0 {
+		s.cancel()
+		return &UnfinishedDeliveriesError{Deliveries: unfinished}
+	}
+	s.cancel()
+	return nil
+}
+
+// getReceiver returns the receiver if the source is started and has not been stopped
+func (s *httpSource) getReceiver() *Receiver {
+	s.receiverLock.RLock()
+	defer s.receiverLock.RUnlock()
+	if s.stopped {
+		return nil
+	}
+	return s.receiver
+}
+
+// track marks the delivery as in-flight, unless the source has been stopped
+func (s *httpSource) track(delivery Delivery) bool {
+	s.receiverLock.RLock()
+	defer s.receiverLock.RUnlock()
+	if s.stopped {
+		return false
+	}
+	s.inFlight.add(delivery)
+	return true
+}
+
+func (s *httpSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	receiver := s.getReceiver()
+	if receiver == nil {
+		http.Error(w, "source has not been started or it has been stopped", http.StatusServiceUnavailable)
+		return
+	}
+	// resolve the queue from the route, falling back to the configured one
+	queue := r.PathValue("queue")
+	if queue == "" {
+		queue = s.queue
+	}
+	if queue == "" {
+		http.Error(w, "queue could not be resolved from the request", http.StatusNotFound)
+		return
+	}
+	// decode the batch of messages, either in the native format or as CloudEvents
+	batch, err := decodeHTTPBatch(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid batch of messages: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	// the deliveries end when either the request or the source is done
+	ctx, cancel := context.WithCancel(extractHTTPTraceContext(r.Context(), r.Header))
+	defer cancel()
+	stop := context.AfterFunc(s.ctx, cancel)
+	defer stop()
+	// deliver the messages one by one and keep track of the outcomes
+	messagesWithHandlers := receiver.GetMessagesWithHandlers(queue)
+	var retryAt time.Time
+	var retry, dropped, stopped bool
+	for _, msg := range batch {
+		if !slices.Contains(messagesWithHandlers, msg.GetName()) {
+			// the queue is not interested in this message, just skip it
+			continue
+		}
+		if msg.isExpired(time.Now()) {
+			// the message is worthless by now, it is skipped as if it was handled
+			continue
+		}
+		delivery := newHTTPDelivery(queue, msg)
+		if !s.track(delivery) {
+			// the source was stopped in the middle of the batch, the sender should try again later
+			stopped = true
+			break
+		}
+		result := receiver.Deliver(ctx, delivery)
+		s.inFlight.remove(delivery)
+		if result == nil {
+			continue
+		}
+		if IsFatal(result) {
+			dropped = true
+			continue
+		}
+		// otherwise, the error means the message should be retried later on
+		messageRetryAt := time.Now().Add(30 * time.Second)
+		var retryErr *retryError
+		if errors.As(result, &retryErr) {
+			messageRetryAt = retryErr.retryAt
+		}
+		if !retry || messageRetryAt.Before(retryAt) {
+			retryAt = messageRetryAt
+		}
+		retry = true
+	}
+	// map the outcomes to a status code, a retry takes precedence over a drop
+	if stopped {
+		http.Error(w, "source has been stopped", http.StatusServiceUnavailable)
+		return
+	}
+	if retry {
+		retryAfter := int(math.Ceil(time.Until(retryAt).Seconds()))
+		if retryAfter < 0 {
+			retryAfter = 0
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "one or more messages should be retried", http.StatusServiceUnavailable)
+		return
+	}
+	if dropped {
+		http.Error(w, "one or more messages were dropped", http.StatusUnprocessableEntity)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func decodeHTTPBatch(r *http.Request) ([]*Message, error) {
+	if isCloudEventsRequest(r) {
+		return decodeCloudEventsRequest(r)
+	}
+	batch := []*Message{}
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
@@ -0,0 +1,144 @@
+package opinionatedevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSource(t *testing.T) {
+	t.Run("delivers a batch of messages to the queue from the route", func(t *testing.T) {
+		received := []string{}
+		handler := newTestHTTPSourceHandler(t, "customers.created", func(_ context.Context, delivery Delivery) error {
+			assert.Equal(t, "local", delivery.GetQueue())
+			assert.Equal(t, 1, delivery.GetAttempt())
+			received = append(received, delivery.GetMessage().GetUUID())
+			return nil
+		})
+		msg1, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		msg2, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		resp := postTestHTTPSourceBatch(t, handler, "/_events/local", msg1, msg2)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, []string{msg1.GetUUID(), msg2.GetUUID()}, received)
+	})
+
+	t.Run("skips messages without a handler", func(t *testing.T) {
+		received := 0
+		handler := newTestHTTPSourceHandler(t, "customers.created", func(_ context.Context, _ Delivery) error {
+			received += 1
+			return nil
+		})
+		msg, err := NewMessage("customers.deleted", nil)
+		assert.NoError(t, err)
+		resp := postTestHTTPSourceBatch(t, handler, "/_events/local", msg)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, 0, received)
+	})
+
+	t.Run("skips expired messages", func(t *testing.T) {
+		received := []string{}
+		handler := newTestHTTPSourceHandler(t, "customers.created", func(_ context.Context, delivery Delivery) error {
+			received = append(received, delivery.GetMessage().GetUUID())
+			return nil
+		})
+		expired, err := NewMessage("customers.created", nil, WithExpiresAt(time.Now().Add(-time.Second)))
+		assert.NoError(t, err)
+		fresh, err := NewMessage("customers.created", nil, WithTTL(time.Minute))
+		assert.NoError(t, err)
+		resp := postTestHTTPSourceBatch(t, handler, "/_events/local", expired, fresh)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, []string{fresh.GetUUID()}, received)
+	})
+
+	t.Run("responds with retry after if a message should be retried", func(t *testing.T) {
+		handler := newTestHTTPSourceHandler(t, "customers.created",
+			WithBackoff(ConstantBackoff(10*time.Second))(func(_ context.Context, _ Delivery) error {
+				return errors.New("just a test")
+			}),
+		)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		resp := postTestHTTPSourceBatch(t, handler, "/_events/local", msg)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+		retryAfter, err := strconv.Atoi(resp.Header().Get("Retry-After"))
+		assert.NoError(t, err)
+		assert.InDelta(t, 10, retryAfter, 1)
+	})
+
+	t.Run("responds with unprocessable entity if a message was dropped", func(t *testing.T) {
+		handler := newTestHTTPSourceHandler(t, "customers.created", func(_ context.Context, _ Delivery) error {
+			return Fatal(errors.New("just a test"))
+		})
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		resp := postTestHTTPSourceBatch(t, handler, "/_events/local", msg)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	})
+
+	t.Run("rejects an invalid batch", func(t *testing.T) {
+		handler := newTestHTTPSourceHandler(t, "customers.created", func(_ context.Context, _ Delivery) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodPost, "/_events/local", bytes.NewBufferString(`{"name":"test"}`))
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("fails if the source has not been started", func(t *testing.T) {
+		source, err := NewHTTPSource(HTTPSourceWithQueue("local"))
+		assert.NoError(t, err)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		resp := postTestHTTPSourceBatch(t, source, "/_events/local", msg)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	})
+
+	t.Run("rejects new batches after stopping", func(t *testing.T) {
+		source, err := NewHTTPSource(HTTPSourceWithQueue("local"))
+		assert.NoError(t, err)
+		receiver, err := NewReceiver(ReceiverWithSource(source))
+		assert.NoError(t, err)
+		assert.NoError(t, receiver.On("local", "customers.created", func(_ context.Context, _ Delivery) error {
+			return nil
+		}))
+		assert.NoError(t, receiver.Start(context.Background()))
+		assert.NoError(t, receiver.Stop(context.Background()))
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		resp := postTestHTTPSourceBatch(t, source, "/_events/local", msg)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	})
+}
+
+func newTestHTTPSourceHandler(t *testing.T, name string, onMessage OnMessageHandler) http.Handler {
+	source, err := NewHTTPSource()
+	assert.NoError(t, err)
+	receiver, err := NewReceiver(ReceiverWithSource(source))
+	assert.NoError(t, err)
+	assert.NoError(t, receiver.On("local", name, onMessage))
+	assert.NoError(t, receiver.Start(context.Background()))
+	mux := http.NewServeMux()
+	mux.Handle("POST /_events/{queue}", source)
+	return mux
+}
+
+func postTestHTTPSourceBatch(t *testing.T, handler http.Handler, path string, batch ...*Message) *httptest.ResponseRecorder {
+	body, err := json.Marshal(batch)
+	assert.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
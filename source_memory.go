@@ -0,0 +1,204 @@
+package opinionatedevents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// memory delivery
+// ---
+
+type memoryDelivery struct {
+	queue   string
+	attempt int
+	message *Message
+}
+
+func newMemoryDelivery(queue string, attempt int, data []byte) (*memoryDelivery, error) {
+	message := &Message{}
+	if err := json.Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+	return &memoryDelivery{queue: queue, attempt: attempt, message: message}, nil
+}
+
+func (d *memoryDelivery) GetAttempt() int {
+	return d.attempt
+}
+
+func (d *memoryDelivery) GetQueue() string {
+	return d.queue
+}
+
+func (d *memoryDelivery) GetMessage() *Message {
+	return d.message
+}
+
+// memory source
+// ---
+
+type memorySource struct {
+	bus              *memoryBus
+	cancel           context.CancelFunc
+	cancelDeliveries context.CancelFunc
+	deliveries       *inFlightDeliveries
+	done             chan struct{}
+	maxWorkers       int
+	receiver         *Receiver
+	inFlight         atomic.Int32
+	wakeup           chan struct{}
+}
+
+type memorySourceOption func(source *memorySource) error
+
+func MemorySourceWithMaxWorkers(maxWorkers uint) memorySourceOption {
+	return func(source *memorySource) error {
+		source.maxWorkers = int(maxWorkers)
+		return nil
+	}
+}
+
+func NewMemorySource(bus *memoryBus, options ...memorySourceOption) (*memorySource, error) {
+	source := &memorySource{
+		bus:        bus,
+		deliveries: newInFlightDeliveries(),
+		done:       make(chan struct{}),
+		maxWorkers: 8,
+		wakeup:     make(chan struct{}, 1),
+	}
+	for _, apply := range options {
+		if err := apply(source); err != nil {
+			return nil, err
+		}
+	}
+	if source.maxWorkers < 1 {
+		return nil, errors.New("max workers must be at least 1")
+	}
+	return source, nil
+}
+
+type MemorySourceQueueDeclareParams struct {
+	Topic string
+	Queue string
+}
+
+func (s *memorySource) QueueDeclare(params *MemorySourceQueueDeclareParams) error {
+	s.bus.declare(params.Topic, params.Queue)
+	return nil
+}
+
+func (s *memorySource) Start(ctx context.Context, receiver *Receiver) error {
+	if s.receiver != nil {
+		return fmt.Errorf("cannot start a source more than once")
+	}
+	s.receiver = receiver
+	// the source can be stopped either by cancelling the context or by calling `Stop`, but only cancelling the context
+	// (or `Stop` running out of time) cancels the context of the in-flight deliveries
+	deliveryCtx, cancelDeliveries := context.WithCancel(ctx)
+	s.cancelDeliveries = cancelDeliveries
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.bus.subscribe(s.wakeup)
+	// collect the messages with handlers for each queue
+	messagesWithHandlers := map[string][]string{}
+	for _, queue := range receiver.GetQueuesWithHandlers() {
+		messagesWithHandlers[queue] = receiver.GetMessagesWithHandlers(queue)
+	}
+	go func() {
+		defer close(s.done)
+		for {
+			s.processUntilNoneLeft(ctx, deliveryCtx, messagesWithHandlers)
+			// wait until something changes or the next scheduled message is due, while every worker is busy only a
+			// finished worker (which notifies the bus) can make progress
+			var due <-chan time.Time
+			if int(s.inFlight.Load()) < s.maxWorkers {
+				if deliverAt, ok := s.bus.nextDeliverAt(messagesWithHandlers, time.Now()); ok {
+					due = time.After(time.Until(deliverAt))
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wakeup:
+			case <-due:
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *memorySource) Stop(ctx context.Context) error {
+	if s.receiver == nil {
+		return fmt.Errorf("cannot stop a source which has not been started")
+	}
+	// stop claiming new messages and wait for the in-flight deliveries to finish
+	s.cancel()
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		s.cancelDeliveries()
+		return ctx.Err()
+	}
+	if unfinished := s.deliveries.wait(ctx); len(unfinished) > 0 {
+		s.cancelDeliveries()
+		return &UnfinishedDeliveriesError{Deliveries: unfinished}
+	}
+	return nil
+}
+
+func (s *memorySource) processUntilNoneLeft(
+	ctx context.Context,
+	deliveryCtx context.Context,
+	messagesWithHandlers map[string][]string,
+) {
+	// NOTE: only this goroutine increments the in-flight counter, so there is no race between the check and the claim
+	for int(s.inFlight.Load()) < s.maxWorkers {
+		if ctx.Err() != nil {
+			return
+		}
+		event := s.bus.claim(messagesWithHandlers, time.Now())
+		if event == nil {
+			return
+		}
+		delivery, err := newMemoryDelivery(event.queue, event.deliveryAttempts, event.payload)
+		if err != nil {
+			// the message can never be decoded, there is no point in retrying it
+			s.bus.release(event, "dropped", event.deliverAt)
+			continue
+		}
+		s.inFlight.Add(1)
+		s.deliveries.add(delivery)
+		go func() {
+			defer func() {
+				s.deliveries.remove(delivery)
+				s.inFlight.Add(-1)
+				s.bus.notify()
+			}()
+			s.processMessage(deliveryCtx, event, delivery)
+		}()
+	}
+}
+
+func (s *memorySource) processMessage(ctx context.Context, event *memoryEvent, delivery *memoryDelivery) {
+	result := s.receiver.Deliver(ctx, delivery)
+	// check if the result was successful
+	if result == nil {
+		s.bus.release(event, "processed", event.deliverAt)
+		return
+	}
+	// check if the result is a fatal error
+	if IsFatal(result) {
+		s.bus.release(event, "dropped", event.deliverAt)
+		return
+	}
+	// otherwise, the error means the message should be retried later on
+	retryAt := time.Now().Add(30 * time.Second)
+	var retryErr *retryError
+	if errors.As(result, &retryErr) {
+		retryAt = retryErr.retryAt
+	}
+	s.bus.release(event, "pending", retryAt)
+}
@@ -0,0 +1,350 @@
+package opinionatedevents
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySource(t *testing.T) {
+	t.Run("delivers a published message to every declared queue", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "two"}))
+		var received atomic.Int32
+		startTestMemoryReceiver(t, source, []string{"one", "two"}, "customers.created",
+			func(_ context.Context, _ Delivery) error {
+				received.Add(1)
+				return nil
+			},
+		)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		assert.Eventually(t, func() bool {
+			return countTestMemoryEvents(bus, "processed") == 2
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, int32(2), received.Load())
+	})
+
+	t.Run("does not route messages to undeclared queues", func(t *testing.T) {
+		bus, publisher, _ := newTestMemoryBus(t)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		assert.Equal(t, 0, countTestMemoryEvents(bus, "pending"))
+	})
+
+	t.Run("drops a message after a fatal error", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		startTestMemoryReceiver(t, source, []string{"one"}, "customers.created",
+			func(_ context.Context, _ Delivery) error {
+				return Fatal(errors.New("just a test"))
+			},
+		)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		assert.Eventually(t, func() bool {
+			return countTestMemoryEvents(bus, "dropped") == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("retries a message at the requested time", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		attempts := []int{}
+		attemptedAt := []time.Time{}
+		startTestMemoryReceiver(t, source, []string{"one"}, "customers.created",
+			WithBackoff(ConstantBackoff(100*time.Millisecond))(func(_ context.Context, delivery Delivery) error {
+				attempts = append(attempts, delivery.GetAttempt())
+				attemptedAt = append(attemptedAt, time.Now())
+				if delivery.GetAttempt() < 2 {
+					return errors.New("just a test")
+				}
+				return nil
+			}),
+		)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		assert.Eventually(t, func() bool {
+			return countTestMemoryEvents(bus, "processed") == 1
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, []int{1, 2}, attempts)
+		assert.GreaterOrEqual(t, attemptedAt[1].Sub(attemptedAt[0]), 100*time.Millisecond)
+	})
+
+	t.Run("does not block an ordering key on a message without a handler", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		unhandled, err := NewMessage("customers.deleted", nil, WithOrderingKey("a"))
+		assert.NoError(t, err)
+		handled, err := NewMessage("customers.updated", nil, WithOrderingKey("a"))
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishMany(context.Background(), []*Message{unhandled, handled}))
+		startTestMemoryReceiver(t, source, []string{"one"}, "customers.updated",
+			func(_ context.Context, _ Delivery) error {
+				return nil
+			},
+		)
+		assert.Eventually(t, func() bool {
+			return countTestMemoryEvents(bus, "processed") == 1
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, 1, countTestMemoryEvents(bus, "pending"))
+	})
+
+	t.Run("marks the expired messages instead of delivering them", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		expired, err := NewMessage("customers.created", nil, WithExpiresAt(time.Now().Add(-time.Second)))
+		assert.NoError(t, err)
+		fresh, err := NewMessage("customers.created", nil, WithTTL(time.Minute))
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishMany(context.Background(), []*Message{expired, fresh}))
+		var received atomic.Int32
+		startTestMemoryReceiver(t, source, []string{"one"}, "customers.created",
+			func(_ context.Context, delivery Delivery) error {
+				assert.Equal(t, fresh.GetUUID(), delivery.GetMessage().GetUUID())
+				received.Add(1)
+				return nil
+			},
+		)
+		assert.Eventually(t, func() bool {
+			return countTestMemoryEvents(bus, "processed") == 1
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, 1, countTestMemoryEvents(bus, "expired"))
+		assert.Equal(t, int32(1), received.Load())
+	})
+
+	t.Run("does not wake up for the messages which are already due", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		messagesWithHandlers := map[string][]string{"one": {"customers.created"}}
+		// a due message waiting for a free worker must not make the source spin
+		due, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), due))
+		_, ok := bus.nextDeliverAt(messagesWithHandlers, time.Now())
+		assert.False(t, ok)
+		deliverAt := time.Now().Add(time.Minute)
+		scheduled, err := NewMessage("customers.created", nil, WithDeliverAt(deliverAt))
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), scheduled))
+		next, ok := bus.nextDeliverAt(messagesWithHandlers, time.Now())
+		assert.True(t, ok)
+		assert.True(t, deliverAt.Equal(next))
+	})
+
+	t.Run("claims the messages with a higher priority first", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		batch := []*Message{}
+		for _, priority := range []int{0, 10, 0, 10} {
+			msg, err := NewMessage("customers.created", nil, WithPriority(priority))
+			assert.NoError(t, err)
+			batch = append(batch, msg)
+		}
+		assert.NoError(t, publisher.PublishMany(context.Background(), batch))
+		claimed := []string{}
+		for range batch {
+			event := bus.claim(map[string][]string{"one": {"customers.created"}}, time.Now())
+			claimed = append(claimed, event.uuid)
+		}
+		assert.Equal(t, []string{
+			batch[1].GetUUID(), batch[3].GetUUID(), batch[0].GetUUID(), batch[2].GetUUID(),
+		}, claimed)
+	})
+
+	t.Run("handles the messages of an ordering key one at a time", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		batch := []*Message{}
+		for _, key := range []string{"a", "a", "b", "a"} {
+			msg, err := NewMessage("customers.updated", nil, WithOrderingKey(key))
+			assert.NoError(t, err)
+			batch = append(batch, msg)
+		}
+		assert.NoError(t, publisher.PublishMany(context.Background(), batch))
+		var mutex sync.Mutex
+		inFlight, handled := map[string]int{}, []string{}
+		startTestMemoryReceiver(t, source, []string{"one"}, "customers.updated",
+			WithBackoff(ConstantBackoff(50*time.Millisecond))(func(_ context.Context, delivery Delivery) error {
+				msg := delivery.GetMessage()
+				mutex.Lock()
+				inFlight[msg.GetOrderingKey()] += 1
+				assert.Equal(t, 1, inFlight[msg.GetOrderingKey()])
+				mutex.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mutex.Lock()
+				defer mutex.Unlock()
+				inFlight[msg.GetOrderingKey()] -= 1
+				// the first message is retried, which blocks the rest of its ordering key
+				if msg.GetUUID() == batch[0].GetUUID() && delivery.GetAttempt() == 1 {
+					return errors.New("just a test")
+				}
+				handled = append(handled, msg.GetUUID())
+				return nil
+			}),
+		)
+		assert.Eventually(t, func() bool {
+			return countTestMemoryEvents(bus, "processed") == 4
+		}, time.Second, 5*time.Millisecond)
+		mutex.Lock()
+		defer mutex.Unlock()
+		// the other ordering key is not blocked by the retried message
+		assert.Equal(t, batch[2].GetUUID(), handled[0])
+		assert.Equal(t, []string{batch[0].GetUUID(), batch[1].GetUUID(), batch[3].GetUUID()}, handled[1:])
+	})
+
+	t.Run("waits until the message is due", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		startTestMemoryReceiver(t, source, []string{"one"}, "customers.created",
+			func(_ context.Context, _ Delivery) error {
+				return nil
+			},
+		)
+		deliverAt := time.Now().Add(100 * time.Millisecond)
+		msg, err := NewMessage("customers.created", nil, WithDeliverAt(deliverAt))
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		assert.Eventually(t, func() bool {
+			return countTestMemoryEvents(bus, "processed") == 1
+		}, time.Second, 5*time.Millisecond)
+		assert.False(t, time.Now().Before(deliverAt))
+	})
+
+	t.Run("stopping waits for the in-flight deliveries", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		started := make(chan struct{})
+		receiver := startTestMemoryReceiver(t, source, []string{"one"}, "customers.created",
+			func(_ context.Context, _ Delivery) error {
+				close(started)
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			},
+		)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		<-started
+		assert.NoError(t, receiver.Stop(context.Background()))
+		assert.Equal(t, 1, countTestMemoryEvents(bus, "processed"))
+	})
+
+	t.Run("stopping reports the deliveries which did not finish in time", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		started, release := make(chan struct{}), make(chan struct{})
+		receiver := startTestMemoryReceiver(t, source, []string{"one"}, "customers.created",
+			func(_ context.Context, _ Delivery) error {
+				close(started)
+				<-release
+				return nil
+			},
+		)
+		defer close(release)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err = receiver.Stop(ctx)
+		var unfinishedErr *UnfinishedDeliveriesError
+		assert.True(t, errors.As(err, &unfinishedErr))
+		assert.Len(t, unfinishedErr.Deliveries, 1)
+		assert.Equal(t, msg.GetUUID(), unfinishedErr.Deliveries[0].GetMessage().GetUUID())
+		assert.Equal(t, 0, countTestMemoryEvents(bus, "processed"))
+	})
+
+	t.Run("cancels the context of the unfinished deliveries when stopping runs out of time", func(t *testing.T) {
+		_, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		started, cancelled := make(chan struct{}), make(chan struct{})
+		receiver := startTestMemoryReceiver(t, source, []string{"one"}, "customers.created",
+			func(ctx context.Context, _ Delivery) error {
+				close(started)
+				<-ctx.Done()
+				close(cancelled)
+				return ctx.Err()
+			},
+		)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		<-started
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		var unfinishedErr *UnfinishedDeliveriesError
+		assert.ErrorAs(t, receiver.Stop(ctx), &unfinishedErr)
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("the context of the delivery was not cancelled")
+		}
+	})
+
+	t.Run("does not deliver new messages after stopping", func(t *testing.T) {
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		receiver := startTestMemoryReceiver(t, source, []string{"one"}, "customers.created",
+			func(_ context.Context, _ Delivery) error {
+				return nil
+			},
+		)
+		assert.NoError(t, receiver.Stop(context.Background()))
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, 1, countTestMemoryEvents(bus, "pending"))
+	})
+}
+
+func newTestMemoryBus(t *testing.T) (*memoryBus, *Publisher, *memorySource) {
+	bus := NewMemoryBus()
+	publisher, err := NewPublisher(PublisherWithSyncBridge(NewMemoryDestination(bus)))
+	assert.NoError(t, err)
+	source, err := NewMemorySource(bus)
+	assert.NoError(t, err)
+	return bus, publisher, source
+}
+
+func startTestMemoryReceiver(
+	t *testing.T,
+	source *memorySource,
+	queues []string,
+	name string,
+	onMessage OnMessageHandler,
+) *Receiver {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	receiver, err := NewReceiver(ReceiverWithSource(source))
+	assert.NoError(t, err)
+	for _, queue := range queues {
+		assert.NoError(t, receiver.On(queue, name, onMessage))
+	}
+	assert.NoError(t, receiver.Start(ctx))
+	return receiver
+}
+
+func countTestMemoryEvents(bus *memoryBus, status string) int {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	count := 0
+	for _, event := range bus.events {
+		if event.status == status {
+			count += 1
+		}
+	}
+	return count
+}
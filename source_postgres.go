@@ -6,11 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
+	"log/slog"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
 
@@ -18,7 +19,7 @@ import (
 // ---
 
 type postgresSourceTrigger interface {
-	Start(ctx context.Context) (chan struct{}, error)
+	Start(ctx context.Context, logger *slog.Logger) (chan struct{}, error)
 }
 
 // interval trigger
@@ -32,7 +33,7 @@ func newPostgresSourceIntervalTrigger(interval time.Duration) *postgresSourceInt
 	return &postgresSourceIntervalTrigger{interval: interval}
 }
 
-func (t *postgresSourceIntervalTrigger) Start(ctx context.Context) (chan struct{}, error) {
+func (t *postgresSourceIntervalTrigger) Start(ctx context.Context, _ *slog.Logger) (chan struct{}, error) {
 	c := make(chan struct{})
 	go func(ctx context.Context) {
 		for {
@@ -63,7 +64,7 @@ func newPostgresSourceNotifyTrigger(connectionString string, channelName string)
 	}
 }
 
-func (t *postgresSourceNotifyTrigger) Start(ctx context.Context) (chan struct{}, error) {
+func (t *postgresSourceNotifyTrigger) Start(ctx context.Context, logger *slog.Logger) (chan struct{}, error) {
 	// init the postgres connection
 	listener := pq.NewListener(
 		t.connectionString,
@@ -71,8 +72,8 @@ func (t *postgresSourceNotifyTrigger) Start(ctx context.Context) (chan struct{},
 		30*time.Second,
 		func(_ pq.ListenerEventType, err error) {
 			if err != nil {
-				// TODO: how to propagate errors? instrument with OpenTelemetry?
-				return
+				// NOTE: the connection will be retried by `*pq.Listener`
+				logger.Warn("postgres listener connection failed", "channel", t.channelName, "error", err)
 			}
 		},
 	)
@@ -91,6 +92,7 @@ func (t *postgresSourceNotifyTrigger) Start(ctx context.Context) (chan struct{},
 			case <-time.After(30 * time.Second):
 				if err := listener.Ping(); err != nil {
 					// NOTE: the connection will be retried by `*pq.Listener`
+					logger.Warn("postgres listener ping failed", "channel", t.channelName, "error", err)
 					continue
 				}
 			case <-listener.Notify:
@@ -113,21 +115,24 @@ func newPostgresSourceAggregateTrigger(triggers ...postgresSourceTrigger) *postg
 	return &postgresSourceAggregateTrigger{triggers: triggers}
 }
 
-func (t *postgresSourceAggregateTrigger) Start(ctx context.Context) (chan struct{}, error) {
-	out := make(chan struct{})
-	var running atomic.Int32
-	// aggregate the triggers
+func (t *postgresSourceAggregateTrigger) Start(ctx context.Context, logger *slog.Logger) (chan struct{}, error) {
+	ins := make([]chan struct{}, 0, len(t.triggers))
 	for _, trigger := range t.triggers {
-		in, err := trigger.Start(ctx)
+		in, err := trigger.Start(ctx, logger)
 		if err != nil {
 			// TODO: what happens to the previously started listeners...? they should be closed?
 			return nil, err
 		}
-		running.Add(1)
+		ins = append(ins, in)
+	}
+	// aggregate the triggers, the output is closed once all of them have been closed
+	out := make(chan struct{})
+	var running atomic.Int32
+	running.Store(int32(len(ins)))
+	for _, in := range ins {
 		go func(in chan struct{}, out chan struct{}) {
 			defer func() {
-				running.Add(-1)
-				if running.Load() == 0 {
+				if running.Add(-1) == 0 {
 					close(out)
 				}
 			}()
@@ -172,12 +177,28 @@ func (d *postgresDelivery) GetMessage() *Message {
 // ---
 
 type postgresSource struct {
+	batchSize      int
+	claims         map[int64]*postgresSourceClaim
+	claimsLock     sync.Mutex
 	db             *sql.DB
+	expiryInterval time.Duration
+	inFlight       *inFlightDeliveries
+	instanceID     string
+	leaseDuration  time.Duration
+	logger         *slog.Logger
 	maxWorkers     int
+	metrics        *postgresSourceMetrics
 	receiver       *Receiver
+	retention      *postgresSourceRetention
 	schema         string
 	skipMigrations bool
+	transactional  bool
 	triggers       []postgresSourceTrigger
+	// lifecycle of a started source
+	cancel              context.CancelFunc
+	cancelDeliveries    context.CancelFunc
+	recorded            chan struct{}
+	stopExtendingLeases func()
 }
 
 type postgresSourceOption func(source *postgresSource) error
@@ -196,6 +217,52 @@ func PostgresSourceWithMaxWorkers(maxWorkers uint) postgresSourceOption {
 	}
 }
 
+// PostgresSourceWithLeaseDuration sets for how long a claimed message is leased to a worker. The lease is
+// extended while the handler is running, and an expired lease (e.g. after a crash) makes the message available again.
+func PostgresSourceWithLeaseDuration(leaseDuration time.Duration) postgresSourceOption {
+	return func(source *postgresSource) error {
+		if leaseDuration <= 0 {
+			return errors.New("lease duration must be positive")
+		}
+		source.leaseDuration = leaseDuration
+		return nil
+	}
+}
+
+// PostgresSourceWithBatchSize sets how many pending messages are claimed, and how many outcomes are recorded, in a
+// single round-trip to the database.
+func PostgresSourceWithBatchSize(batchSize uint) postgresSourceOption {
+	return func(source *postgresSource) error {
+		if batchSize == 0 {
+			return errors.New("batch size must be at least 1")
+		}
+		source.batchSize = int(batchSize)
+		return nil
+	}
+}
+
+// PostgresSourceWithLogger sets the logger used by the source and its migrations, defaults to `slog.Default()`.
+func PostgresSourceWithLogger(logger *slog.Logger) postgresSourceOption {
+	return func(source *postgresSource) error {
+		if logger == nil {
+			return errors.New("logger cannot be nil")
+		}
+		source.logger = logger
+		return nil
+	}
+}
+
+// PostgresSourceWithTransactionalHandlers runs every handler within a transaction, which is available to the handler
+// with `TxFromContext`. A handler which succeeds commits its writes atomically with the message being marked as
+// processed, and a handler which fails rolls them back. The messages published with the context of the handler (and a
+// Postgres destination) are inserted within the same transaction.
+func PostgresSourceWithTransactionalHandlers() postgresSourceOption {
+	return func(source *postgresSource) error {
+		source.transactional = true
+		return nil
+	}
+}
+
 func PostgresSourceWithIntervalTrigger(interval time.Duration) postgresSourceOption {
 	return func(source *postgresSource) error {
 		source.triggers = append(source.triggers, newPostgresSourceIntervalTrigger(interval))
@@ -212,7 +279,14 @@ func PostgresSourceWithNotifyTrigger(connectionString string) postgresSourceOpti
 
 func NewPostgresSource(db *sql.DB, options ...postgresSourceOption) (*postgresSource, error) {
 	source := &postgresSource{
+		batchSize:      16,
+		claims:         map[int64]*postgresSourceClaim{},
 		db:             db,
+		expiryInterval: 1 * time.Minute,
+		inFlight:       newInFlightDeliveries(),
+		instanceID:     uuid.NewString(),
+		leaseDuration:  1 * time.Minute,
+		logger:         slog.Default(),
 		maxWorkers:     8,
 		schema:         "opinionatedevents",
 		skipMigrations: false,
@@ -229,7 +303,7 @@ func NewPostgresSource(db *sql.DB, options ...postgresSourceOption) (*postgresSo
 	}
 	// make sure the migrations are run
 	if !source.skipMigrations {
-		if err := migrate(db, source.schema); err != nil {
+		if err := migrate(db, source.schema, source.logger); err != nil {
 			return nil, err
 		}
 	}
@@ -265,247 +339,613 @@ func (s *postgresSource) Start(ctx context.Context, receiver *Receiver) error {
 		return fmt.Errorf("cannot start a source more than once")
 	}
 	s.receiver = receiver
+	// the source can be stopped either by cancelling the context or by calling `Stop`, but only cancelling the context
+	// (or `Stop` running out of time) cancels the context of the in-flight deliveries
+	deliveryCtx, cancelDeliveries := context.WithCancel(ctx)
+	s.cancelDeliveries = cancelDeliveries
+	ctx, s.cancel = context.WithCancel(ctx)
 	// create and start an aggregate trigger
 	trigger := newPostgresSourceAggregateTrigger(s.triggers...)
-	triggerChan, err := trigger.Start(ctx)
+	triggerChan, err := trigger.Start(ctx, s.logger)
 	if err != nil {
 		return err
 	}
-	// fan-out the triggers to worker triggers
-	workerTriggerChans := make([]chan struct{}, s.maxWorkers)
-	for i := range workerTriggerChans {
-		workerTriggerChans[i] = make(chan struct{})
-	}
+	// coalesce the triggers so that a long round of processing never blocks them
+	wakeup := make(chan struct{}, 1)
 	go func() {
-		for {
-			val, ok := <-triggerChan
-			for _, out := range workerTriggerChans {
-				if !ok {
-					close(out)
-				} else {
-					out <- val
-				}
-			}
-			if !ok {
-				break
+		for range triggerChan {
+			select {
+			case wakeup <- struct{}{}:
+			default:
+				// there is already a pending wakeup, no need for another one
 			}
 		}
+		close(wakeup)
 	}()
-	// launch the workers
+	// launch the workers which deliver the claimed messages to the receiver
+	claimed := make(chan *postgresSourceClaimedMessage)
+	outcomes := make(chan *postgresSourceOutcome)
+	var workers sync.WaitGroup
 	for i := 0; i < s.maxWorkers; i += 1 {
-		go func(ctx context.Context, trigger chan struct{}) {
-			var mutex sync.Mutex
-			processing := false
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case _, ok := <-trigger:
-					if !ok {
-						return
-					}
-					mutex.Lock()
-					if processing {
-						// we were already processing pending messages, just skip the trigger
-						mutex.Unlock()
-						continue
-					}
-					// start processing pending messages from this trigger
-					processing = true
-					mutex.Unlock()
-					// process in a goroutine so that the triggers are not blocked
-					go func() {
-						defer func() {
-							mutex.Lock()
-							processing = false
-							mutex.Unlock()
-						}()
-						if err := s.processUntilNoneLeft(); err != nil {
-							// TODO: the errored messages will be retried on next trigger, but should log somehow
-							goto outside
-						}
-					outside:
-					}()
-				}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for message := range claimed {
+				outcomes <- s.processMessage(deliveryCtx, message)
 			}
-		}(ctx, workerTriggerChans[i])
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(outcomes)
+	}()
+	// record the outcomes in bulk, and keep the leases of the in-flight messages alive until then
+	s.recorded = make(chan struct{})
+	go func() {
+		defer close(s.recorded)
+		s.recordOutcomesUntilClosed(outcomes)
+	}()
+	leasesDone := make(chan struct{})
+	s.stopExtendingLeases = sync.OnceFunc(func() { close(leasesDone) })
+	go func() {
+		defer s.stopExtendingLeases()
+		<-s.recorded
+	}()
+	go s.extendLeasesUntilDone(leasesDone)
+	// mark the expired messages in the background, outside of the claim round trips
+	go s.expireMessagesUntilDone(ctx)
+	// remove old processed and dropped messages in the background, if configured
+	if s.retention != nil {
+		go s.removeFinishedUntilDone(ctx)
+	}
+	// report the queue metrics in the background, if configured
+	if s.metrics != nil {
+		go s.reportQueueMetricsUntilDone(ctx)
 	}
+	// claim pending messages in batches on every trigger
+	go func() {
+		defer close(claimed)
+		for range wakeup {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := s.claimUntilNoneLeft(ctx, claimed); err != nil {
+				// NOTE: the messages will be claimed again on the next trigger
+				s.logger.ErrorContext(ctx, "failed to claim messages", "error", err)
+				continue
+			}
+		}
+	}()
 	return nil
 }
 
-func (s *postgresSource) processUntilNoneLeft() error {
-	// limit the number of processed messages to `n`
+func (s *postgresSource) Stop(ctx context.Context) error {
+	if s.receiver == nil {
+		return fmt.Errorf("cannot stop a source which has not been started")
+	}
+	// stop claiming new messages
+	s.cancel()
+	// wait for the in-flight deliveries to finish
+	if unfinished := s.inFlight.wait(ctx); len(unfinished) > 0 {
+		// NOTE: the leases of the unfinished messages will expire, after which they can be claimed again
+		s.stopExtendingLeases()
+		s.cancelDeliveries()
+		return &UnfinishedDeliveriesError{Deliveries: unfinished}
+	}
+	// wait for the outcomes to be recorded
+	select {
+	case <-s.recorded:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// postgresSourceClaim identifies a single claim of a message, the delivery attempts act as a fencing token
+type postgresSourceClaim struct {
+	id       int64
+	attempts int64
+}
+
+type postgresSourceClaimedMessage struct {
+	claim   *postgresSourceClaim
+	queue   string
+	payload string
+}
+
+type postgresSourceOutcome struct {
+	claim      *postgresSourceClaim
+	result     error
+	startedAt  time.Time
+	finishedAt time.Time
+	// the message expired while it was waiting for a worker, so it was not delivered at all
+	expired bool
+	// the outcome was already recorded within the transaction of the handler
+	recorded bool
+}
+
+func (s *postgresSource) claimUntilNoneLeft(ctx context.Context, claimed chan<- *postgresSourceClaimedMessage) error {
+	// limit the number of claimed messages to `n`
 	foundMaxLimit, foundCount := 500, 0
-	// process the pending messages one by one, in a transaction
-	visitedMessageIds := []int64{}
-	nonEmptyQueues := append([]string{}, s.receiver.GetQueuesWithHandlers()...)
-	for {
-		tx, err := s.db.Begin()
+	for foundCount < foundMaxLimit && ctx.Err() == nil {
+		limit := min(s.batchSize, foundMaxLimit-foundCount)
+		messages, err := s.claimNextMessages(limit)
 		if err != nil {
 			return err
 		}
-		// pick a random non-empty queue to pull messages from
-		selectedQueue := nonEmptyQueues[rand.Intn(len(nonEmptyQueues))]
-		messagesWithHandlers := s.receiver.GetMessagesWithHandlers(selectedQueue)
-		// attempt to process the next available message from the queue
-		id, err := s.processNextMessage(tx, []string{selectedQueue}, messagesWithHandlers, visitedMessageIds)
-		if err != nil {
-			// a non-nil error means that something very unexpected (e.g. network down) happened -> rollback
-			if err := tx.Rollback(); err != nil {
-				return err
+		// NOTE: this blocks until there are free workers, the leases are kept alive in the meantime
+		for i, message := range messages {
+			select {
+			case claimed <- message:
+			case <-ctx.Done():
+				// the source is stopping, give the rest of the messages back without counting them as attempts
+				return s.releaseClaims(messages[i:])
 			}
-			return err
-		}
-		if err := tx.Commit(); err != nil {
-			return err
 		}
-		// an id of -1 means that there was no pending messages left
-		found := id > -1
-		if found {
-			visitedMessageIds = append(visitedMessageIds, id)
-			foundCount += 1
-		} else {
-			nonEmptyQueues = filter(nonEmptyQueues, func(item string, _ int) bool {
-				return item != selectedQueue
-			})
-		}
-		// check if there are possibly more pending messages
-		isBelowLimit := foundCount < foundMaxLimit
-		hasNonEmptyQueues := len(nonEmptyQueues) > 0
-		if !(isBelowLimit && hasNonEmptyQueues) {
+		foundCount += len(messages)
+		// a partial batch means that there were no pending messages left
+		if len(messages) < limit {
 			break
 		}
 	}
 	return nil
 }
 
-func (s *postgresSource) processNextMessage(
-	tx *sql.Tx,
-	queuesToPullFrom []string,
-	messagesWithHandlers []string,
-	visitedMessageIds []int64,
-) (int64, error) {
-	// define the required SQL queries
-	selectNextEventQuery := withSchema(
+func (s *postgresSource) claimNextMessages(limit int) ([]*postgresSourceClaimedMessage, error) {
+	claimNextEventsQuery := withSchema(
 		`
-		SELECT id, uuid, queue, payload, delivery_attempts
-		FROM :SCHEMA.events
-		WHERE
-			status = 'pending' AND
-			queue = ANY($1) AND
-			name = ANY($2) AND
-			NOT (id = ANY($3)) AND
-			deliver_at <= $4
-		ORDER BY published_at ASC
-		LIMIT 1
-		FOR UPDATE SKIP LOCKED
+		UPDATE :SCHEMA.events AS e
+		SET
+			locked_until = $4,
+			locked_by = $5,
+			delivery_attempts = e.delivery_attempts + 1
+		FROM (
+			SELECT c.id
+			FROM (SELECT DISTINCT unnest($1::text[]) AS queue) AS q
+			CROSS JOIN LATERAL (
+				SELECT n.id, n.claim_at
+				FROM :SCHEMA.events AS n
+				WHERE
+					n.status = 'pending' AND
+					n.queue = q.queue AND
+					(n.queue, n.name) IN (SELECT * FROM unnest($1::text[], $2::text[])) AND
+					n.deliver_at <= $3 AND
+					(n.locked_until IS NULL OR n.locked_until <= $3) AND
+					(n.expires_at IS NULL OR n.expires_at > $3) AND
+					-- only the first pending message of an ordering key can be claimed, the in-flight and the retrying
+					-- messages are still pending so they block the messages after them, while the messages without a
+					-- handler on the queue stay pending forever so they must not block anything, and neither must the
+					-- expired messages which have not been marked as such yet
+					(n.ordering_key IS NULL OR NOT EXISTS (
+						SELECT 1
+						FROM :SCHEMA.events AS p
+						WHERE
+							p.status = 'pending' AND
+							p.queue = n.queue AND
+							(p.queue, p.name) IN (SELECT * FROM unnest($1::text[], $2::text[])) AND
+							p.ordering_key = n.ordering_key AND
+							(p.expires_at IS NULL OR p.expires_at > $3) AND
+							p.id < n.id
+					))
+				-- the higher priorities are served first, but a message which has waited for long enough overtakes
+				-- them so that the lower priorities are not starved (see the claim_at column)
+				ORDER BY n.claim_at ASC, n.id ASC
+				LIMIT $6
+				FOR UPDATE SKIP LOCKED
+			) AS c
+			-- the queues take turns in the batch, so that a busy queue cannot fill it and starve the others
+			ORDER BY
+				row_number() OVER (PARTITION BY q.queue ORDER BY c.claim_at ASC, c.id ASC),
+				c.claim_at ASC,
+				c.id ASC
+			LIMIT $6
+		) AS c
+		WHERE e.id = c.id
+		RETURNING e.id, e.queue, e.payload, e.delivery_attempts
 		`,
 		s.schema,
 	)
-	updateStatusQuery := withSchema(
+	queues, names := s.handledMessages()
+	now := time.Now().UTC()
+	// NOTE: the delivery attempt is recorded when claiming, so that crashing handlers are counted as well
+	rows, err := s.db.Query(claimNextEventsQuery,
+		pq.Array(queues),
+		pq.Array(names),
+		now,
+		now.Add(s.leaseDuration),
+		s.instanceID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	messages := []*postgresSourceClaimedMessage{}
+	for rows.Next() {
+		message := &postgresSourceClaimedMessage{claim: &postgresSourceClaim{}}
+		if err := rows.Scan(
+			&message.claim.id,
+			&message.queue,
+			&message.payload,
+			&message.claim.attempts,
+		); err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.addClaims(messages...)
+	return messages, nil
+}
+
+// handledMessages returns the (queue, name) pairs which have a handler, as two arrays of the same length
+func (s *postgresSource) handledMessages() ([]string, []string) {
+	queues, names := []string{}, []string{}
+	for _, queue := range s.receiver.GetQueuesWithHandlers() {
+		for _, name := range s.receiver.GetMessagesWithHandlers(queue) {
+			queues = append(queues, queue)
+			names = append(names, name)
+		}
+	}
+	return queues, names
+}
+
+func (s *postgresSource) expireMessagesUntilDone(ctx context.Context) {
+	for {
+		queues, names := s.handledMessages()
+		if err := s.expireMessages(queues, names, time.Now().UTC()); err != nil && ctx.Err() == nil {
+			// NOTE: the claims skip the expired messages anyway, they are only marked on the next round
+			s.logger.ErrorContext(ctx, "failed to mark the expired messages", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.expiryInterval):
+		}
+	}
+}
+
+// expireMessages marks the pending messages which have expired by the given time as `expired`, the messages which are
+// being handled are left for their handlers
+func (s *postgresSource) expireMessages(queues []string, names []string, now time.Time) error {
+	expireEventsQuery := withSchema(
 		`
-		UPDATE :SCHEMA.events
-		SET status = $1
-		WHERE queue = $2 AND uuid = $3
+		UPDATE :SCHEMA.events AS e
+		SET
+			status = 'expired',
+			finished_at = $3,
+			locked_until = NULL,
+			locked_by = NULL
+		FROM (
+			SELECT n.id
+			FROM :SCHEMA.events AS n
+			WHERE
+				n.status = 'pending' AND
+				n.expires_at <= $3 AND
+				(n.queue, n.name) IN (SELECT * FROM unnest($1::text[], $2::text[])) AND
+				(n.locked_until IS NULL OR n.locked_until <= $3)
+			FOR UPDATE SKIP LOCKED
+		) AS x
+		WHERE e.id = x.id
 		`,
 		s.schema,
 	)
-	incrementDeliveryAttemptsQuery := withSchema(
+	result, err := s.db.Exec(expireEventsQuery, pq.Array(queues), pq.Array(names), now)
+	if err != nil {
+		return err
+	}
+	if expired, err := result.RowsAffected(); err == nil && expired > 0 {
+		s.logger.Debug("marked the expired messages", "count", expired)
+	}
+	return nil
+}
+
+func (s *postgresSource) processMessage(ctx context.Context, message *postgresSourceClaimedMessage) *postgresSourceOutcome {
+	outcome := &postgresSourceOutcome{claim: message.claim, startedAt: time.Now()}
+	delivery, err := newPostgresDelivery(message.queue, int(message.claim.attempts), []byte(message.payload))
+	if err != nil {
+		// the message can never be decoded, there is no point in retrying it
+		s.logger.ErrorContext(ctx, "failed to decode a message, dropping it",
+			"queue", message.queue,
+			"attempt", message.claim.attempts,
+			"error", err,
+		)
+		outcome.result = Fatal(err)
+		outcome.finishedAt = time.Now()
+		return outcome
+	}
+	// the message may have expired while it was waiting for a worker
+	if delivery.GetMessage().isExpired(time.Now()) {
+		outcome.expired = true
+		outcome.finishedAt = time.Now()
+		return outcome
+	}
+	s.inFlight.add(delivery)
+	defer s.inFlight.remove(delivery)
+	if s.transactional {
+		s.deliverWithinTx(ctx, delivery, outcome)
+		return outcome
+	}
+	outcome.result = s.receiver.Deliver(ctx, delivery)
+	outcome.finishedAt = time.Now()
+	return outcome
+}
+
+// deliverWithinTx delivers the message within a transaction, and records a successful outcome within the same
+// transaction so that the writes of the handler are committed only if the message is marked as processed
+func (s *postgresSource) deliverWithinTx(ctx context.Context, delivery Delivery, outcome *postgresSourceOutcome) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		// NOTE: the message is retried like any other failed delivery
+		outcome.result = fmt.Errorf("failed to begin the transaction of the handler: %w", err)
+		outcome.finishedAt = time.Now()
+		return
+	}
+	defer tx.Rollback() //nolint the error is not relevant
+	outcome.result = s.receiver.Deliver(WithTx(ctx, tx), delivery)
+	outcome.finishedAt = time.Now()
+	if outcome.result != nil {
+		// the writes of the handler are rolled back, and the outcome is recorded as usual
+		return
+	}
+	if err := s.recordOutcomesWithinTx(tx, []*postgresSourceOutcome{outcome}); err != nil {
+		// NOTE: the writes of the handler are rolled back and the message is claimed again once the lease expires
+		s.logger.ErrorContext(ctx, "failed to record the outcome of a message",
+			append(deliveryLogAttrs(delivery), "error", err)...,
+		)
+		outcome.recorded = true
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		s.logger.ErrorContext(ctx, "failed to commit the transaction of the handler",
+			append(deliveryLogAttrs(delivery), "error", err)...,
+		)
+	}
+	outcome.recorded = true
+}
+
+func (s *postgresSource) recordOutcomesUntilClosed(outcomes <-chan *postgresSourceOutcome) {
+	for outcome := range outcomes {
+		// collect the outcomes which are immediately available into a single batch
+		batch := []*postgresSourceOutcome{outcome}
+	collect:
+		for len(batch) < s.batchSize {
+			select {
+			case outcome, ok := <-outcomes:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, outcome)
+			default:
+				break collect
+			}
+		}
+		// the outcomes of the transactional handlers are already recorded, only their claims are released
+		toBeRecorded := []*postgresSourceOutcome{}
+		for _, outcome := range batch {
+			if !outcome.recorded {
+				toBeRecorded = append(toBeRecorded, outcome)
+			}
+		}
+		if len(toBeRecorded) > 0 {
+			if err := s.recordOutcomes(toBeRecorded); err != nil {
+				// NOTE: the leases will expire and the messages will be claimed again
+				s.logger.Error("failed to record the outcomes of messages", "size", len(toBeRecorded), "error", err)
+			}
+		}
+		claims := make([]*postgresSourceClaim, len(batch))
+		for i, outcome := range batch {
+			claims[i] = outcome.claim
+		}
+		s.removeClaims(claims...)
+	}
+}
+
+func (s *postgresSource) recordOutcomes(outcomes []*postgresSourceOutcome) error {
+	// write all of the outcomes back in a single transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint the error is not relevant
+	if err := s.recordOutcomesWithinTx(tx, outcomes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *postgresSource) recordOutcomesWithinTx(tx *sql.Tx, outcomes []*postgresSourceOutcome) error {
+	updateOutcomesQuery := withSchema(
 		`
-		UPDATE :SCHEMA.events
-		SET delivery_attempts = delivery_attempts + 1
-		WHERE queue = $1 AND uuid = $2
+		WITH o AS (
+			SELECT *
+			FROM unnest($1::bigint[], $2::integer[], $3::text[], $4::text[], $5::text[], $6::text[], $7::text[])
+				AS o(id, attempts, status, deliver_at, error, started_at, finished_at)
+		), updated AS (
+			UPDATE :SCHEMA.events AS e
+			SET
+				status = o.status,
+				deliver_at = COALESCE(NULLIF(o.deliver_at, '')::timestamptz, e.deliver_at),
+				finished_at = CASE WHEN o.status = 'pending' THEN NULL ELSE now() END,
+				locked_until = NULL,
+				locked_by = NULL
+			FROM o
+			WHERE e.id = o.id AND e.delivery_attempts = o.attempts AND e.locked_by = $8
+			RETURNING e.id, e.status
+		), dead_lettered AS (
+			INSERT INTO :SCHEMA.dead_letters (event_id, error)
+			SELECT updated.id, o.error
+			FROM updated JOIN o ON o.id = updated.id
+			WHERE updated.status = 'dropped'
+			ON CONFLICT (event_id) DO UPDATE SET
+				dropped_at = now(),
+				error = excluded.error
+		), attempts_recorded AS (
+			INSERT INTO :SCHEMA.delivery_attempts (event_id, attempt, started_at, finished_at, outcome, error, retry_at)
+			SELECT
+				updated.id,
+				o.attempts,
+				o.started_at::timestamptz,
+				o.finished_at::timestamptz,
+				CASE updated.status WHEN 'pending' THEN 'retry' ELSE updated.status END,
+				NULLIF(o.error, ''),
+				NULLIF(o.deliver_at, '')::timestamptz
+			FROM updated JOIN o ON o.id = updated.id
+			-- the expired messages were never delivered
+			WHERE updated.status <> 'expired'
+		)
+		SELECT count(*) FROM updated
 		`,
 		s.schema,
 	)
-	updateDeliverAtQuery := withSchema(
+	ids := make([]int64, len(outcomes))
+	attempts := make([]int64, len(outcomes))
+	statuses := make([]string, len(outcomes))
+	deliverAts := make([]string, len(outcomes))
+	errs := make([]string, len(outcomes))
+	startedAts := make([]string, len(outcomes))
+	finishedAts := make([]string, len(outcomes))
+	for i, outcome := range outcomes {
+		ids[i] = outcome.claim.id
+		attempts[i] = outcome.claim.attempts
+		startedAts[i] = outcome.startedAt.UTC().Format(time.RFC3339Nano)
+		finishedAts[i] = outcome.finishedAt.UTC().Format(time.RFC3339Nano)
+		statuses[i], deliverAts[i], errs[i] = "processed", "", ""
+		if outcome.expired {
+			statuses[i] = "expired"
+			continue
+		}
+		if outcome.result == nil {
+			continue
+		}
+		errs[i] = outcome.result.Error()
+		// check if the result is a fatal error, the error is kept as the reason for dropping the message
+		var fatalErr *fatalError
+		if errors.As(outcome.result, &fatalErr) {
+			statuses[i] = "dropped"
+			continue
+		}
+		// otherwise, the error means the message should be retried later on
+		retryAt := time.Now().Add(30 * time.Second)
+		// try to override the default retry at time from the error
+		var retryErr *retryError
+		if errors.As(outcome.result, &retryErr) {
+			retryAt = retryErr.retryAt
+		}
+		statuses[i] = "pending"
+		deliverAts[i] = retryAt.UTC().Format(time.RFC3339Nano)
+	}
+	row := tx.QueryRow(updateOutcomesQuery,
+		pq.Array(ids),
+		pq.Array(attempts),
+		pq.Array(statuses),
+		pq.Array(deliverAts),
+		pq.Array(errs),
+		pq.Array(startedAts),
+		pq.Array(finishedAts),
+		s.instanceID,
+	)
+	var rowCount int64
+	if err := row.Scan(&rowCount); err != nil {
+		return err
+	}
+	// the lease may have expired and the message claimed by someone else, in which case the outcome is discarded
+	if lost := int64(len(outcomes)) - rowCount; lost > 0 {
+		return fmt.Errorf("the lease of %d message(s) was lost before recording the outcome", lost)
+	}
+	return nil
+}
+
+func (s *postgresSource) releaseClaims(messages []*postgresSourceClaimedMessage) error {
+	releaseClaimsQuery := withSchema(
 		`
-		UPDATE :SCHEMA.events
-		SET deliver_at = $1
-		WHERE queue = $2 AND uuid = $3
+		UPDATE :SCHEMA.events AS e
+		SET
+			locked_until = NULL,
+			locked_by = NULL,
+			delivery_attempts = e.delivery_attempts - 1
+		FROM unnest($1::bigint[], $2::integer[]) AS c(id, attempts)
+		WHERE e.id = c.id AND e.delivery_attempts = c.attempts AND e.locked_by = $3
 		`,
 		s.schema,
 	)
-	// attempt to fetch the next pending message from the database
-	row := tx.QueryRow(selectNextEventQuery,
-		pq.Array(queuesToPullFrom),
-		pq.Array(messagesWithHandlers),
-		pq.Array(visitedMessageIds),
-		time.Now().UTC(),
-	)
-	var id int64
-	var uuid string
-	var queue string
-	var payload string
-	var deliveryAttempts int64
-	if err := row.Scan(&id, &uuid, &queue, &payload, &deliveryAttempts); err != nil {
-		if err == sql.ErrNoRows {
-			// there was no pending messages left -> return the id of -1 to indicate the outcome
-			return -1, nil
-		}
-		return -1, err
+	ids := make([]int64, len(messages))
+	attempts := make([]int64, len(messages))
+	claims := make([]*postgresSourceClaim, len(messages))
+	for i, message := range messages {
+		ids[i] = message.claim.id
+		attempts[i] = message.claim.attempts
+		claims[i] = message.claim
 	}
-	// a pending message was found, construct a delivery and attempt to deliver it to the receiver
-	delivery, err := newPostgresDelivery(queue, int(deliveryAttempts)+1, []byte(payload))
-	if err != nil {
-		return id, err
-	}
-	ctx := context.Background() // TODO: should something be injected into the context?
-	result := s.receiver.Deliver(ctx, delivery)
-	// record the delivery attempt regardless of the outcome
-	if result, err := tx.Exec(incrementDeliveryAttemptsQuery, queue, uuid); err != nil {
-		return id, err
-	} else {
-		if rowCount, err := result.RowsAffected(); err != nil {
-			return id, err
-		} else if rowCount != 1 {
-			return id, errors.New("could not increment delivery attempts")
+	defer s.removeClaims(claims...)
+	// NOTE: if this fails, the leases will expire and the messages can be claimed again
+	_, err := s.db.Exec(releaseClaimsQuery, pq.Array(ids), pq.Array(attempts), s.instanceID)
+	return err
+}
+
+// in-flight claims and their leases
+// ---
+
+func (s *postgresSource) addClaims(messages ...*postgresSourceClaimedMessage) {
+	s.claimsLock.Lock()
+	defer s.claimsLock.Unlock()
+	for _, message := range messages {
+		s.claims[message.claim.id] = message.claim
+	}
+}
+
+func (s *postgresSource) removeClaims(claims ...*postgresSourceClaim) {
+	s.claimsLock.Lock()
+	defer s.claimsLock.Unlock()
+	for _, claim := range claims {
+		if s.claims[claim.id] == claim {
+			delete(s.claims, claim.id)
 		}
 	}
-	// check if the result was successful
-	if result == nil {
-		// mark as processed
-		if result, err := tx.Exec(updateStatusQuery, "processed", queue, uuid); err != nil {
-			return id, err
-		} else {
-			if rowCount, err := result.RowsAffected(); err != nil {
-				return id, err
-			} else if rowCount != 1 {
-				return id, errors.New(`could not update message status to "processed"`)
+}
+
+func (s *postgresSource) getClaimedIDs() []int64 {
+	s.claimsLock.Lock()
+	defer s.claimsLock.Unlock()
+	ids := make([]int64, 0, len(s.claims))
+	for id := range s.claims {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// extendLeasesUntilDone keeps extending the leases of the in-flight messages so that long-running handlers,
+// or messages waiting for a free worker, do not lose them
+func (s *postgresSource) extendLeasesUntilDone(done <-chan struct{}) {
+	extendLeasesQuery := withSchema(
+		`
+		UPDATE :SCHEMA.events
+		SET locked_until = $1
+		WHERE id = ANY($2) AND locked_by = $3
+		`,
+		s.schema,
+	)
+	ticker := time.NewTicker(s.leaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ids := s.getClaimedIDs()
+			if len(ids) == 0 {
+				continue
 			}
-		}
-		return id, nil
-	}
-	// check if the result is a fatal error
-	var fatalErr *fatalError
-	if errors.As(result, &fatalErr) {
-		// drop the message
-		if result, err := tx.Exec(updateStatusQuery, "dropped", queue, uuid); err != nil {
-			return id, err
-		} else {
-			if rowCount, err := result.RowsAffected(); err != nil {
-				return id, err
-			} else if rowCount != 1 {
-				return id, errors.New(`could not update message status to "dropped"`)
+			// NOTE: a failed extension is retried on the next tick, and at worst the leases will expire
+			if _, err := s.db.Exec(extendLeasesQuery,
+				time.Now().Add(s.leaseDuration).UTC(),
+				pq.Array(ids),
+				s.instanceID,
+			); err != nil {
+				s.logger.Warn("failed to extend the leases of messages", "size", len(ids), "error", err)
 			}
 		}
-		return id, nil
-	}
-	// otherwise, the error means the message should be retried later on
-	retryAt := time.Now().Add(30 * time.Second)
-	// try to override the default retry at time from the error
-	var retryErr *retryError
-	if errors.As(result, &retryErr) {
-		retryAt = retryErr.retryAt
-	}
-	if result, err := tx.Exec(updateDeliverAtQuery, retryAt.UTC(), queue, uuid); err != nil {
-		return id, err
-	} else {
-		if rowCount, err := result.RowsAffected(); err != nil {
-			return id, err
-		} else if rowCount != 1 {
-			return id, errors.New("could not update message delivery time")
-		}
 	}
-	return id, nil
 }
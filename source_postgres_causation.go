@@ -0,0 +1,82 @@
+package opinionatedevents
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PostgresCausalEvent struct {
+	UUID          string
+	Name          string
+	PublishedAt   time.Time
+	CorrelationID string
+	// CausationID is empty for the message which started the chain
+	CausationID string
+	// Queues are the queues the message was routed to
+	Queues []string
+}
+
+// GetCausalChain returns the chain of messages the given message belongs to: the messages which (transitively) caused
+// it, the message itself and the messages it (transitively) caused, in the order they were published. Messages which
+// were published without a correlation id are not part of any chain.
+func (s *postgresSource) GetCausalChain(uuid string) ([]*PostgresCausalEvent, error) {
+	getCausalChainQuery := withSchema(
+		`
+		WITH RECURSIVE chain AS (
+			SELECT
+				uuid,
+				min(name) AS name,
+				min(published_at) AS published_at,
+				min(correlation_id) AS correlation_id,
+				min(causation_id) AS causation_id,
+				array_agg(queue ORDER BY queue) AS queues
+			FROM :SCHEMA.events
+			WHERE correlation_id = (
+				SELECT correlation_id FROM :SCHEMA.events WHERE uuid = $1 AND correlation_id IS NOT NULL LIMIT 1
+			)
+			GROUP BY uuid
+		), causes AS (
+			SELECT chain.* FROM chain WHERE uuid = $1
+			UNION
+			SELECT chain.* FROM chain JOIN causes ON chain.uuid = causes.causation_id
+		), effects AS (
+			SELECT chain.* FROM chain WHERE uuid = $1
+			UNION
+			SELECT chain.* FROM chain JOIN effects ON chain.causation_id = effects.uuid
+		)
+		SELECT uuid, name, published_at, correlation_id, causation_id, queues FROM causes
+		UNION
+		SELECT uuid, name, published_at, correlation_id, causation_id, queues FROM effects
+		ORDER BY published_at ASC, uuid ASC
+		`,
+		s.schema,
+	)
+	rows, err := s.db.Query(getCausalChainQuery, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []*PostgresCausalEvent{}
+	for rows.Next() {
+		event := &PostgresCausalEvent{}
+		var causationID sql.NullString
+		if err := rows.Scan(
+			&event.UUID,
+			&event.Name,
+			&event.PublishedAt,
+			&event.CorrelationID,
+			&causationID,
+			pq.Array(&event.Queues),
+		); err != nil {
+			return nil, err
+		}
+		event.CausationID = causationID.String
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
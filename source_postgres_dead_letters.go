@@ -0,0 +1,203 @@
+package opinionatedevents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type PostgresDroppedEvent struct {
+	Queue            string
+	UUID             string
+	Name             string
+	PublishedAt      time.Time
+	DeliveryAttempts int
+	// DroppedAt is zero and Error empty for messages dropped before the reasons were recorded
+	DroppedAt time.Time
+	Error     string
+	// Message is nil if the stored message could not be decoded
+	Message *Message
+}
+
+type PostgresSourceDroppedFilter struct {
+	Queue string
+	// the rest of the fields are optional, and a zero value matches every dropped message
+	Name          string
+	DroppedAfter  time.Time
+	DroppedBefore time.Time
+}
+
+// where returns the conditions matching the filter, for a query with the aliases `e` (events) and `d` (dead letters)
+func (f *PostgresSourceDroppedFilter) where(params *[]any) (string, error) {
+	if f.Queue == "" {
+		return "", errors.New("queue must be defined when filtering dropped messages")
+	}
+	asParam := func(v any) string {
+		*params = append(*params, v)
+		return fmt.Sprintf("$%d", len(*params))
+	}
+	conditions := []string{
+		"e.status = 'dropped'",
+		fmt.Sprintf("e.queue = %s", asParam(f.Queue)),
+	}
+	if f.Name != "" {
+		conditions = append(conditions, fmt.Sprintf("e.name = %s", asParam(f.Name)))
+	}
+	if !f.DroppedAfter.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("d.dropped_at >= %s", asParam(f.DroppedAfter.UTC())))
+	}
+	if !f.DroppedBefore.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("d.dropped_at < %s", asParam(f.DroppedBefore.UTC())))
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// ListDropped lists at most `limit` dropped messages matching the filter, the most recently dropped first.
+func (s *postgresSource) ListDropped(filter *PostgresSourceDroppedFilter, limit int) ([]*PostgresDroppedEvent, error) {
+	params := []any{}
+	where, err := filter.where(&params)
+	if err != nil {
+		return nil, err
+	}
+	params = append(params, limit)
+	listDroppedQuery := withSchema(
+		fmt.Sprintf(
+			`
+			SELECT e.queue, e.uuid, e.name, e.published_at, e.delivery_attempts, d.dropped_at, d.error, e.payload
+			FROM :SCHEMA.events AS e
+			LEFT JOIN :SCHEMA.dead_letters AS d ON d.event_id = e.id
+			WHERE %s
+			ORDER BY d.dropped_at DESC NULLS LAST, e.id DESC
+			LIMIT $%d
+			`,
+			where, len(params),
+		),
+		s.schema,
+	)
+	rows, err := s.db.Query(listDroppedQuery, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dropped := []*PostgresDroppedEvent{}
+	for rows.Next() {
+		event, err := scanPostgresDroppedEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		dropped = append(dropped, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return dropped, nil
+}
+
+// GetDropped returns a single dropped message, or `sql.ErrNoRows` if the message has not been dropped.
+func (s *postgresSource) GetDropped(queue string, uuid string) (*PostgresDroppedEvent, error) {
+	getDroppedQuery := withSchema(
+		`
+		SELECT e.queue, e.uuid, e.name, e.published_at, e.delivery_attempts, d.dropped_at, d.error, e.payload
+		FROM :SCHEMA.events AS e
+		LEFT JOIN :SCHEMA.dead_letters AS d ON d.event_id = e.id
+		WHERE e.status = 'dropped' AND e.queue = $1 AND e.uuid = $2
+		`,
+		s.schema,
+	)
+	return scanPostgresDroppedEvent(s.db.QueryRow(getDroppedQuery, queue, uuid))
+}
+
+// Requeue makes a single dropped message pending again with its delivery attempts reset.
+func (s *postgresSource) Requeue(queue string, uuid string) error {
+	params := []any{queue, uuid}
+	requeued, err := s.requeue("e.status = 'dropped' AND e.queue = $1 AND e.uuid = $2", params)
+	if err != nil {
+		return err
+	}
+	if requeued != 1 {
+		return fmt.Errorf(`message "%s" from queue "%s" has not been dropped`, uuid, queue)
+	}
+	return nil
+}
+
+// RequeueDropped makes every dropped message matching the filter pending again, and returns their count.
+func (s *postgresSource) RequeueDropped(filter *PostgresSourceDroppedFilter) (int64, error) {
+	params := []any{}
+	where, err := filter.where(&params)
+	if err != nil {
+		return 0, err
+	}
+	return s.requeue(where, params)
+}
+
+func (s *postgresSource) requeue(where string, params []any) (int64, error) {
+	params = append(params, time.Now().UTC())
+	requeueQuery := withSchema(
+		fmt.Sprintf(
+			`
+			WITH requeued AS (
+				UPDATE :SCHEMA.events
+				SET
+					status = 'pending',
+					delivery_attempts = 0,
+					deliver_at = $%d,
+					finished_at = NULL,
+					locked_until = NULL,
+					locked_by = NULL
+				WHERE id IN (
+					SELECT e.id
+					FROM :SCHEMA.events AS e
+					LEFT JOIN :SCHEMA.dead_letters AS d ON d.event_id = e.id
+					WHERE %s
+				)
+				RETURNING id
+			), deleted AS (
+				DELETE FROM :SCHEMA.dead_letters
+				WHERE event_id IN (SELECT id FROM requeued)
+			)
+			SELECT count(*) FROM requeued
+			`,
+			len(params), where,
+		),
+		s.schema,
+	)
+	var count int64
+	if err := s.db.QueryRow(requeueQuery, params...).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+type postgresRowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPostgresDroppedEvent(row postgresRowScanner) (*PostgresDroppedEvent, error) {
+	event := &PostgresDroppedEvent{}
+	var droppedAt sql.NullTime
+	var droppedError sql.NullString
+	var payload string
+	if err := row.Scan(
+		&event.Queue,
+		&event.UUID,
+		&event.Name,
+		&event.PublishedAt,
+		&event.DeliveryAttempts,
+		&droppedAt,
+		&droppedError,
+		&payload,
+	); err != nil {
+		return nil, err
+	}
+	event.DroppedAt = droppedAt.Time
+	event.Error = droppedError.String
+	// NOTE: the message is left nil if it cannot be decoded, which may well be the reason it was dropped
+	message := &Message{}
+	if err := json.Unmarshal([]byte(payload), message); err == nil {
+		event.Message = message
+	}
+	return event, nil
+}
@@ -0,0 +1,64 @@
+package opinionatedevents
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PostgresDeliveryAttempt struct {
+	Attempt   int
+	StartedAt time.Time
+	Duration  time.Duration
+	// Outcome is one of "processed", "retry" or "dropped"
+	Outcome string
+	// Error is empty if the attempt was successful
+	Error string
+	// RetryAt is zero unless the outcome was a retry
+	RetryAt time.Time
+}
+
+// ListDeliveryAttempts lists the recorded delivery attempts of a message in the order they were made. An attempt is
+// recorded only once its outcome is known, so attempts interrupted by e.g. a crash are not listed.
+func (s *postgresSource) ListDeliveryAttempts(queue string, uuid string) ([]*PostgresDeliveryAttempt, error) {
+	listDeliveryAttemptsQuery := withSchema(
+		`
+		SELECT a.attempt, a.started_at, a.finished_at, a.outcome, a.error, a.retry_at
+		FROM :SCHEMA.delivery_attempts AS a
+		JOIN :SCHEMA.events AS e ON e.id = a.event_id
+		WHERE e.queue = $1 AND e.uuid = $2
+		-- the attempt numbers start over when a message is requeued, so they cannot be used for the order
+		ORDER BY a.id ASC
+		`,
+		s.schema,
+	)
+	rows, err := s.db.Query(listDeliveryAttemptsQuery, queue, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attempts := []*PostgresDeliveryAttempt{}
+	for rows.Next() {
+		attempt := &PostgresDeliveryAttempt{}
+		var finishedAt time.Time
+		var attemptError sql.NullString
+		var retryAt sql.NullTime
+		if err := rows.Scan(
+			&attempt.Attempt,
+			&attempt.StartedAt,
+			&finishedAt,
+			&attempt.Outcome,
+			&attemptError,
+			&retryAt,
+		); err != nil {
+			return nil, err
+		}
+		attempt.Duration = finishedAt.Sub(attempt.StartedAt)
+		attempt.Error = attemptError.String
+		attempt.RetryAt = retryAt.Time
+		attempts = append(attempts, attempt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
@@ -0,0 +1,82 @@
+package opinionatedevents
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type postgresSourceMetrics struct {
+	metrics  Metrics
+	interval time.Duration
+}
+
+// PostgresSourceWithMetrics periodically reports the depth and the age of the oldest due message of every queue with
+// handlers, so that growing backlogs can be alerted on. The gauges are refreshed every `interval`.
+func PostgresSourceWithMetrics(metrics Metrics, interval time.Duration) postgresSourceOption {
+	return func(source *postgresSource) error {
+		if metrics == nil {
+			return errors.New("metrics cannot be nil")
+		}
+		if interval <= 0 {
+			return errors.New("interval must be positive")
+		}
+		source.metrics = &postgresSourceMetrics{metrics: metrics, interval: interval}
+		return nil
+	}
+}
+
+func (s *postgresSource) reportQueueMetricsUntilDone(ctx context.Context) {
+	for {
+		if err := s.reportQueueMetrics(ctx); err != nil && ctx.Err() == nil {
+			// NOTE: the gauges keep their previous values until the next round
+			s.logger.ErrorContext(ctx, "failed to read the queue metrics", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.metrics.interval):
+		}
+	}
+}
+
+func (s *postgresSource) reportQueueMetrics(ctx context.Context) error {
+	readQueueMetricsQuery := withSchema(
+		`
+		SELECT
+			queue,
+			count(*),
+			COALESCE(EXTRACT(EPOCH FROM $1 - min(deliver_at) FILTER (WHERE deliver_at <= $1)), 0)
+		FROM :SCHEMA.events
+		WHERE status = 'pending' AND queue = ANY($2)
+		GROUP BY queue
+		`,
+		s.schema,
+	)
+	queues := s.receiver.GetQueuesWithHandlers()
+	rows, err := s.db.QueryContext(ctx, readQueueMetricsQuery, time.Now().UTC(), pq.Array(queues))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	// the queues without pending messages are not returned, but they should be reported as empty
+	depths, ages := map[string]float64{}, map[string]float64{}
+	for rows.Next() {
+		var queue string
+		var depth, age float64
+		if err := rows.Scan(&queue, &depth, &age); err != nil {
+			return err
+		}
+		depths[queue], ages[queue] = depth, age
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, queue := range queues {
+		s.metrics.metrics.SetGauge(MetricQueueDepth, Labels{"queue": queue}, depths[queue])
+		s.metrics.metrics.SetGauge(MetricQueueOldestPendingAge, Labels{"queue": queue}, ages[queue])
+	}
+	return nil
+}
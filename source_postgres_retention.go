@@ -0,0 +1,92 @@
+package opinionatedevents
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type postgresSourceRetention struct {
+	processed time.Duration
+	dropped   time.Duration
+	interval  time.Duration
+	batchSize int
+}
+
+// PostgresSourceWithRetention removes processed and dropped messages (with their delivery history) once they have
+// been in that status for the given duration. A zero duration keeps the messages with that status forever. The expired
+// messages are kept for as long as the processed ones.
+func PostgresSourceWithRetention(processed time.Duration, dropped time.Duration) postgresSourceOption {
+	return func(source *postgresSource) error {
+		if processed < 0 || dropped < 0 {
+			return errors.New("retention must not be negative")
+		}
+		source.retention = &postgresSourceRetention{
+			processed: processed,
+			dropped:   dropped,
+			interval:  1 * time.Minute,
+			batchSize: 1000,
+		}
+		return nil
+	}
+}
+
+func (s *postgresSource) removeFinishedUntilDone(ctx context.Context) {
+	for {
+		for _, policy := range []struct {
+			status    string
+			retention time.Duration
+		}{
+			{status: "processed", retention: s.retention.processed},
+			{status: "dropped", retention: s.retention.dropped},
+			{status: "expired", retention: s.retention.processed},
+		} {
+			if policy.retention == 0 {
+				continue
+			}
+			if err := s.removeFinished(ctx, policy.status, time.Now().Add(-policy.retention)); err != nil {
+				// NOTE: the messages will be removed on the next round
+				s.logger.ErrorContext(ctx, "failed to remove old messages", "status", policy.status, "error", err)
+				continue
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.retention.interval):
+		}
+	}
+}
+
+// removeFinished removes the messages which reached the status before the given time, in batches so that no long
+// running transactions are needed. Multiple instances can run this concurrently as the locked rows are skipped.
+func (s *postgresSource) removeFinished(ctx context.Context, status string, finishedBefore time.Time) error {
+	removeFinishedQuery := withSchema(
+		`
+		DELETE FROM :SCHEMA.events
+		WHERE id IN (
+			SELECT id
+			FROM :SCHEMA.events
+			WHERE status = $1 AND finished_at < $2
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		`,
+		s.schema,
+	)
+	for ctx.Err() == nil {
+		result, err := s.db.ExecContext(ctx, removeFinishedQuery, status, finishedBefore.UTC(), s.retention.batchSize)
+		if err != nil {
+			return err
+		}
+		rowCount, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		// a partial batch means that there were no old messages left
+		if rowCount < int64(s.retention.batchSize) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package opinionatedevents
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/markusylisiurunen/go-opinionatedevents"
+
+func newTracer(provider trace.TracerProvider) trace.Tracer {
+	return provider.Tracer(tracerName)
+}
+
+// messageTraceCarrier stores the trace context of a message in its meta, so that it is persisted with the message
+type messageTraceCarrier struct {
+	msg *Message
+}
+
+func (c messageTraceCarrier) Get(key string) string {
+	return c.msg.trace[key]
+}
+
+func (c messageTraceCarrier) Set(key string, value string) {
+	if c.msg.trace == nil {
+		c.msg.trace = map[string]string{}
+	}
+	c.msg.trace[key] = value
+}
+
+func (c messageTraceCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.trace))
+	for key := range c.msg.trace {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// startPublishSpan starts a span for publishing the batch and injects its trace context into every message
+func startPublishSpan(ctx context.Context, tracer trace.Tracer, batch []*Message) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "opinionatedevents"),
+		attribute.String("messaging.operation.type", "publish"),
+		attribute.Int("messaging.batch.message_count", len(batch)),
+	}
+	if len(batch) == 1 {
+		attrs = append(attrs,
+			attribute.String("messaging.message.id", batch[0].GetUUID()),
+			attribute.String("messaging.destination.name", batch[0].GetTopic()),
+		)
+	}
+	ctx, span := tracer.Start(ctx, "publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attrs...),
+	)
+	for _, msg := range batch {
+		otel.GetTextMapPropagator().Inject(ctx, messageTraceCarrier{msg: msg})
+	}
+	return ctx, span
+}
+
+// startProcessSpan starts a span for processing the delivery. The span is a child of the publish span, unless the
+// context already has a span (e.g. an incoming HTTP request), in which case the publish span is linked instead.
+func startProcessSpan(ctx context.Context, tracer trace.Tracer, delivery Delivery) (context.Context, trace.Span) {
+	msg := delivery.GetMessage()
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "opinionatedevents"),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.String("messaging.destination.name", delivery.GetQueue()),
+			attribute.String("messaging.message.id", msg.GetUUID()),
+			attribute.String("messaging.message.name", msg.GetName()),
+			attribute.Int("messaging.message.delivery_attempt", delivery.GetAttempt()),
+		),
+	}
+	published := trace.SpanContextFromContext(
+		otel.GetTextMapPropagator().Extract(context.Background(), messageTraceCarrier{msg: msg}),
+	)
+	if parent := trace.SpanContextFromContext(ctx); parent.IsValid() {
+		if published.IsValid() && !published.Equal(parent) {
+			options = append(options, trace.WithLinks(trace.Link{SpanContext: published}))
+		}
+	} else if published.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, published)
+	}
+	return tracer.Start(ctx, "process", options...)
+}
+
+// endSpan records the possible error of the operation and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectHTTPTraceContext adds the trace context to the headers of an outgoing request
+func injectHTTPTraceContext(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// extractHTTPTraceContext restores the trace context from the headers of an incoming request, unless the context
+// already has a span (e.g. from an instrumented HTTP server)
+func extractHTTPTraceContext(ctx context.Context, header http.Header) context.Context {
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
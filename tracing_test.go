@@ -0,0 +1,93 @@
+package opinionatedevents
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+	t.Run("continues the publish trace in the handler", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		bus := NewMemoryBus()
+		publisher, err := NewPublisher(
+			PublisherWithSyncBridge(NewMemoryDestination(bus)),
+			PublisherWithTracerProvider(provider),
+		)
+		assert.NoError(t, err)
+		source, err := NewMemorySource(bus)
+		assert.NoError(t, err)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		receiver, err := NewReceiver(ReceiverWithSource(source), ReceiverWithTracerProvider(provider))
+		assert.NoError(t, err)
+		handled := make(chan trace.SpanContext, 1)
+		assert.NoError(t, receiver.On("one", "customers.created", func(ctx context.Context, _ Delivery) error {
+			handled <- trace.SpanContextFromContext(ctx)
+			return nil
+		}))
+		assert.NoError(t, receiver.Start(context.Background()))
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		var handlerSpan trace.SpanContext
+		select {
+		case handlerSpan = <-handled:
+		case <-time.After(time.Second):
+			t.Fatal("the message was not handled")
+		}
+		assert.NoError(t, receiver.Stop(context.Background()))
+		spans := recorder.Ended()
+		assert.Len(t, spans, 2)
+		publishSpan, processSpan := spans[0], spans[1]
+		assert.Equal(t, "publish", publishSpan.Name())
+		assert.Equal(t, trace.SpanKindProducer, publishSpan.SpanKind())
+		assert.Equal(t, "process", processSpan.Name())
+		assert.Equal(t, trace.SpanKindConsumer, processSpan.SpanKind())
+		assert.Equal(t, publishSpan.SpanContext().TraceID(), processSpan.SpanContext().TraceID())
+		assert.Equal(t, publishSpan.SpanContext().SpanID(), processSpan.Parent().SpanID())
+		assert.Equal(t, processSpan.SpanContext().SpanID(), handlerSpan.SpanID())
+	})
+
+	t.Run("propagates the trace over http", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		source, err := NewHTTPSource(HTTPSourceWithQueue("local"))
+		assert.NoError(t, err)
+		receiver, err := NewReceiver(ReceiverWithSource(source), ReceiverWithTracerProvider(provider))
+		assert.NoError(t, err)
+		assert.NoError(t, receiver.On("local", "customers.created", func(_ context.Context, _ Delivery) error {
+			return nil
+		}))
+		assert.NoError(t, receiver.Start(context.Background()))
+		server := httptest.NewServer(source)
+		defer server.Close()
+		publisher, err := NewPublisher(
+			PublisherWithSyncBridge(NewHTTPDestination(server.URL)),
+			PublisherWithTracerProvider(provider),
+		)
+		assert.NoError(t, err)
+		msg, err := NewMessage("customers.created", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		spans := recorder.Ended()
+		assert.Len(t, spans, 2)
+		processSpan, publishSpan := spans[0], spans[1]
+		assert.Equal(t, "process", processSpan.Name())
+		assert.Equal(t, "publish", publishSpan.Name())
+		assert.Equal(t, publishSpan.SpanContext().SpanID(), processSpan.Parent().SpanID())
+		assert.True(t, processSpan.Parent().IsRemote())
+		assert.Empty(t, processSpan.Links())
+	})
+}
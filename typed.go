@@ -0,0 +1,100 @@
+package opinionatedevents
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// MessageDefinition ties the name of a message to the type of its payload, so that the publishers and the handlers
+// of the message cannot drift apart. It is meant to be declared once and shared, e.g.
+//
+//	var CustomerCreated = events.Define[CustomerCreatedPayload]("customers.created")
+type MessageDefinition[T any] struct {
+	name    string
+	options []MessageOption
+}
+
+// Define declares a message with the given name and payload type. The options are applied to every message created
+// with `New` before the options given to it, e.g. `WithCodec(ProtobufCodec)`.
+func Define[T any](name string, options ...MessageOption) *MessageDefinition[T] {
+	return &MessageDefinition[T]{name: name, options: options}
+}
+
+func (d *MessageDefinition[T]) Name() string {
+	return d.name
+}
+
+// New creates a new message of the definition with the given payload.
+func (d *MessageDefinition[T]) New(payload T, options ...MessageOption) (*Message, error) {
+	return NewMessage(d.name, payload, append(append([]MessageOption{}, d.options...), options...)...)
+}
+
+// Handler adapts a typed handler to an `OnMessageHandler`. The payload is decoded once before the handler is called,
+// and a payload which cannot be decoded is dropped as it would never succeed.
+func (d *MessageDefinition[T]) Handler(onMessage func(ctx context.Context, delivery TypedDelivery[T]) error) OnMessageHandler {
+	return func(ctx context.Context, delivery Delivery) error {
+		msg := delivery.GetMessage()
+		if msg.GetName() != d.name {
+			return Fatal(fmt.Errorf(`expected message "%s", got "%s"`, d.name, msg.GetName()))
+		}
+		payload, err := decodeTypedPayload[T](msg)
+		if err != nil {
+			return Fatal(fmt.Errorf(`failed to decode the payload of message "%s": %w`, d.name, err))
+		}
+		return onMessage(ctx, &typedDelivery[T]{Delivery: delivery, payload: payload})
+	}
+}
+
+// OnTyped registers a typed handler for the message of the definition, see `Receiver.On`. A definition with a version
+// (i.e. `WithVersion`) expects the payloads to be of that version, see `Receiver.OnVersion`.
+func OnTyped[T any](
+	r *Receiver,
+	queue string,
+	definition *MessageDefinition[T],
+	onMessage func(ctx context.Context, delivery TypedDelivery[T]) error,
+) error {
+	if version := definition.version(); version > 0 {
+		return r.OnVersion(queue, definition.name, version, definition.Handler(onMessage))
+	}
+	return r.On(queue, definition.name, definition.Handler(onMessage))
+}
+
+// version returns the version set by the options of the definition, or 0 if there is none
+func (d *MessageDefinition[T]) version() int {
+	msg := &Message{}
+	for _, option := range d.options {
+		option(msg)
+	}
+	return msg.version
+}
+
+// TypedDelivery is a delivery with the payload already decoded to the type of the message definition.
+type TypedDelivery[T any] interface {
+	Delivery
+	GetPayload() T
+}
+
+type typedDelivery[T any] struct {
+	Delivery
+	payload T
+}
+
+func (d *typedDelivery[T]) GetPayload() T {
+	return d.payload
+}
+
+func decodeTypedPayload[T any](msg *Message) (T, error) {
+	var payload T
+	// a pointer type (e.g. a protobuf message) is decoded into a newly allocated value, as some codecs do not allocate
+	// the value of a nil pointer by themselves
+	if t := reflect.TypeFor[T](); t.Kind() == reflect.Pointer {
+		value := reflect.New(t.Elem())
+		if err := msg.GetPayload(value.Interface()); err != nil {
+			return payload, err
+		}
+		return value.Interface().(T), nil
+	}
+	err := msg.GetPayload(&payload)
+	return payload, err
+}
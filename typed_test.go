@@ -0,0 +1,75 @@
+package opinionatedevents
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testCustomerCreated struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestMessageDefinition(t *testing.T) {
+	t.Run("delivers the decoded payload to a typed handler", func(t *testing.T) {
+		customerCreated := Define[testCustomerCreated]("customers.created")
+		bus, publisher, source := newTestMemoryBus(t)
+		assert.NoError(t, source.QueueDeclare(&MemorySourceQueueDeclareParams{Topic: "customers", Queue: "one"}))
+		receiver, err := NewReceiver(ReceiverWithSource(source))
+		assert.NoError(t, err)
+		received := make(chan testCustomerCreated, 1)
+		assert.NoError(t, OnTyped(receiver, "one", customerCreated,
+			func(_ context.Context, delivery TypedDelivery[testCustomerCreated]) error {
+				assert.Equal(t, "one", delivery.GetQueue())
+				received <- delivery.GetPayload()
+				return nil
+			},
+		))
+		assert.NoError(t, receiver.Start(context.Background()))
+		msg, err := customerCreated.New(testCustomerCreated{ID: "1", Name: "Acme"})
+		assert.NoError(t, err)
+		assert.Equal(t, "customers.created", msg.GetName())
+		assert.NoError(t, publisher.PublishOne(context.Background(), msg))
+		select {
+		case payload := <-received:
+			assert.Equal(t, testCustomerCreated{ID: "1", Name: "Acme"}, payload)
+		case <-time.After(time.Second):
+			t.Fatal("the message was not handled")
+		}
+		assert.Eventually(t, func() bool {
+			return countTestMemoryEvents(bus, "processed") == 1
+		}, time.Second, 5*time.Millisecond)
+		assert.NoError(t, receiver.Stop(context.Background()))
+	})
+
+	t.Run("decodes a pointer payload with the codec of the definition", func(t *testing.T) {
+		customerCreated := Define[*wrapperspb.StringValue]("customers.created", WithCodec(ProtobufCodec))
+		msg, err := customerCreated.New(wrapperspb.String("42"), WithHeader("tenant", "acme"))
+		assert.NoError(t, err)
+		assert.Equal(t, "application/protobuf", msg.GetContentType())
+		assert.Equal(t, "acme", msg.GetHeader("tenant"))
+		handler := customerCreated.Handler(
+			func(_ context.Context, delivery TypedDelivery[*wrapperspb.StringValue]) error {
+				assert.Equal(t, "42", delivery.GetPayload().GetValue())
+				return nil
+			},
+		)
+		assert.NoError(t, handler(context.Background(), &testDelivery{1, "default", msg}))
+	})
+
+	t.Run("drops a message with a payload which cannot be decoded", func(t *testing.T) {
+		customerCreated := Define[testCustomerCreated]("customers.created")
+		msg, err := NewMessage("customers.created", "not an object")
+		assert.NoError(t, err)
+		handler := customerCreated.Handler(func(_ context.Context, _ TypedDelivery[testCustomerCreated]) error {
+			t.Fatal("the handler should not be called")
+			return nil
+		})
+		err = handler(context.Background(), &testDelivery{1, "default", msg})
+		assert.True(t, IsFatal(err))
+	})
+}
@@ -0,0 +1,90 @@
+package opinionatedevents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Upcaster transforms an encoded payload from one version to the next one. The payload is in the content type of the
+// message, see `JSONUpcaster` for the JSON payloads.
+type Upcaster func(payload []byte) ([]byte, error)
+
+// JSONUpcaster adapts a function which modifies a decoded JSON payload in place to an `Upcaster`.
+func JSONUpcaster(upcast func(payload map[string]any) error) Upcaster {
+	return func(data []byte) ([]byte, error) {
+		payload := map[string]any{}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &payload); err != nil {
+				return nil, err
+			}
+		}
+		if err := upcast(payload); err != nil {
+			return nil, err
+		}
+		return json.Marshal(payload)
+	}
+}
+
+// UpcasterRegistry holds the upcasters of every message, keyed by the message name and the version they upcast from.
+type UpcasterRegistry struct {
+	mutex     sync.RWMutex
+	upcasters map[string]map[int]Upcaster
+}
+
+func NewUpcasterRegistry() *UpcasterRegistry {
+	return &UpcasterRegistry{upcasters: map[string]map[int]Upcaster{}}
+}
+
+// Register adds the upcaster which transforms the payloads of the message from the given version to the next one.
+func (r *UpcasterRegistry) Register(name string, fromVersion int, upcaster Upcaster) error {
+	if fromVersion < 1 {
+		return errors.New("version must be at least 1")
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.upcasters[name]; !ok {
+		r.upcasters[name] = map[int]Upcaster{}
+	}
+	if _, ok := r.upcasters[name][fromVersion]; ok {
+		return fmt.Errorf(`an upcaster for message "%s" from version %d already exists`, name, fromVersion)
+	}
+	r.upcasters[name][fromVersion] = upcaster
+	return nil
+}
+
+// Latest returns the latest version of the message, i.e. the version after the last upcaster or 1 if there are none.
+func (r *UpcasterRegistry) Latest(name string) int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	latest := 1
+	for fromVersion := range r.upcasters[name] {
+		latest = max(latest, fromVersion+1)
+	}
+	return latest
+}
+
+// Upcast returns a copy of the message with its payload upcasted to the given version, one version at a time.
+func (r *UpcasterRegistry) Upcast(msg *Message, version int) (*Message, error) {
+	if msg.GetVersion() > version {
+		return nil, fmt.Errorf(`cannot downcast message "%s" from version %d to %d`, msg.GetName(), msg.GetVersion(), version)
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	payload := msg.payload
+	for from := msg.GetVersion(); from < version; from += 1 {
+		upcaster, ok := r.upcasters[msg.GetName()][from]
+		if !ok {
+			return nil, fmt.Errorf(`no upcaster for message "%s" from version %d`, msg.GetName(), from)
+		}
+		var err error
+		if payload, err = upcaster(payload); err != nil {
+			return nil, fmt.Errorf(`failed to upcast message "%s" from version %d: %w`, msg.GetName(), from, err)
+		}
+	}
+	upcasted := *msg
+	upcasted.payload = payload
+	upcasted.version = version
+	return &upcasted, nil
+}
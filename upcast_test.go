@@ -0,0 +1,141 @@
+package opinionatedevents
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestUpcasterRegistry(t *testing.T) *UpcasterRegistry {
+	registry := NewUpcasterRegistry()
+	// v1 -> v2 splits the name into a first and a last name
+	assert.NoError(t, registry.Register("customers.created", 1, JSONUpcaster(func(payload map[string]any) error {
+		payload["first_name"], payload["last_name"] = payload["name"], ""
+		delete(payload, "name")
+		return nil
+	})))
+	// v2 -> v3 adds a default country
+	assert.NoError(t, registry.Register("customers.created", 2, JSONUpcaster(func(payload map[string]any) error {
+		payload["country"] = "FI"
+		return nil
+	})))
+	return registry
+}
+
+func TestUpcasterRegistry(t *testing.T) {
+	registry := newTestUpcasterRegistry(t)
+
+	t.Run("knows the latest version of a message", func(t *testing.T) {
+		assert.Equal(t, 3, registry.Latest("customers.created"))
+		assert.Equal(t, 1, registry.Latest("customers.deleted"))
+	})
+
+	t.Run("upcasts a payload one version at a time", func(t *testing.T) {
+		msg, err := NewMessage("customers.created", map[string]any{"name": "Jane"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, msg.GetVersion())
+		upcasted, err := registry.Upcast(msg, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, upcasted.GetVersion())
+		assert.Equal(t, msg.GetUUID(), upcasted.GetUUID())
+		assert.JSONEq(t, `{"first_name":"Jane","last_name":"","country":"FI"}`, string(upcasted.payload))
+		// the original message is left as is
+		assert.Equal(t, 1, msg.GetVersion())
+		assert.JSONEq(t, `{"name":"Jane"}`, string(msg.payload))
+	})
+
+	t.Run("does not register an upcaster twice", func(t *testing.T) {
+		assert.Error(t, registry.Register("customers.created", 1, JSONUpcaster(func(_ map[string]any) error {
+			return nil
+		})))
+	})
+
+	t.Run("fails if an upcaster is missing", func(t *testing.T) {
+		msg, err := NewMessage("customers.created", map[string]any{}, WithVersion(3))
+		assert.NoError(t, err)
+		_, err = registry.Upcast(msg, 4)
+		assert.ErrorContains(t, err, "no upcaster")
+	})
+
+	t.Run("round-trips the version of a message", func(t *testing.T) {
+		msg, err := NewMessage("customers.created", nil, WithVersion(2))
+		assert.NoError(t, err)
+		data, err := json.Marshal(msg)
+		assert.NoError(t, err)
+		received := &Message{}
+		assert.NoError(t, json.Unmarshal(data, received))
+		assert.Equal(t, 2, received.GetVersion())
+	})
+}
+
+func TestReceiverWithUpcasters(t *testing.T) {
+	newTestReceiver := func(t *testing.T, register func(r *Receiver, onMessage OnMessageHandler) error) (*Receiver, chan *Message) {
+		receiver, err := NewReceiver(ReceiverWithUpcasters(newTestUpcasterRegistry(t)))
+		assert.NoError(t, err)
+		received := make(chan *Message, 1)
+		assert.NoError(t, register(receiver, func(_ context.Context, delivery Delivery) error {
+			received <- delivery.GetMessage()
+			return nil
+		}))
+		assert.NoError(t, receiver.Start(context.Background()))
+		return receiver, received
+	}
+
+	t.Run("upcasts to the latest version by default", func(t *testing.T) {
+		receiver, received := newTestReceiver(t, func(r *Receiver, onMessage OnMessageHandler) error {
+			return r.On("default", "customers.created", onMessage)
+		})
+		msg, err := NewMessage("customers.created", map[string]any{"name": "Jane"})
+		assert.NoError(t, err)
+		assert.NoError(t, receiver.Deliver(context.Background(), &testDelivery{1, "default", msg}))
+		upcasted := <-received
+		assert.Equal(t, 3, upcasted.GetVersion())
+		assert.JSONEq(t, `{"first_name":"Jane","last_name":"","country":"FI"}`, string(upcasted.payload))
+	})
+
+	t.Run("upcasts to the version expected by the handler", func(t *testing.T) {
+		receiver, received := newTestReceiver(t, func(r *Receiver, onMessage OnMessageHandler) error {
+			return r.OnVersion("default", "customers.created", 2, onMessage)
+		})
+		msg, err := NewMessage("customers.created", map[string]any{"name": "Jane"})
+		assert.NoError(t, err)
+		assert.NoError(t, receiver.Deliver(context.Background(), &testDelivery{1, "default", msg}))
+		upcasted := <-received
+		assert.Equal(t, 2, upcasted.GetVersion())
+		assert.JSONEq(t, `{"first_name":"Jane","last_name":""}`, string(upcasted.payload))
+	})
+
+	t.Run("retries a message newer than the handler", func(t *testing.T) {
+		receiver, _ := newTestReceiver(t, func(r *Receiver, onMessage OnMessageHandler) error {
+			return r.OnVersion("default", "customers.created", 2, onMessage)
+		})
+		msg, err := NewMessage("customers.created", map[string]any{}, WithVersion(3))
+		assert.NoError(t, err)
+		err = receiver.Deliver(context.Background(), &testDelivery{1, "default", msg})
+		assert.ErrorContains(t, err, "newer version")
+		assert.False(t, IsFatal(err))
+	})
+
+	t.Run("upcasts the payload of a typed handler", func(t *testing.T) {
+		type customerCreatedV2 struct {
+			FirstName string `json:"first_name"`
+		}
+		customerCreated := Define[customerCreatedV2]("customers.created", WithVersion(2))
+		receiver, err := NewReceiver(ReceiverWithUpcasters(newTestUpcasterRegistry(t)))
+		assert.NoError(t, err)
+		received := make(chan customerCreatedV2, 1)
+		assert.NoError(t, OnTyped(receiver, "default", customerCreated,
+			func(_ context.Context, delivery TypedDelivery[customerCreatedV2]) error {
+				received <- delivery.GetPayload()
+				return nil
+			},
+		))
+		assert.NoError(t, receiver.Start(context.Background()))
+		msg, err := NewMessage("customers.created", map[string]any{"name": "Jane"})
+		assert.NoError(t, err)
+		assert.NoError(t, receiver.Deliver(context.Background(), &testDelivery{1, "default", msg}))
+		assert.Equal(t, "Jane", (<-received).FirstName)
+	})
+}